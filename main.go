@@ -1,16 +1,128 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/takashabe/thyella/thyella"
+	"go.uber.org/zap"
 )
 
+// Env represents environments, which override the config file.
 type Env struct {
-	ProjectID string   `envconfig:"project_id"`
-	Cluster   string   `envconfig:"cluster"`
-	NodePools []string `envconfig:"node_pools"`
+	Config    string         `envconfig:"config"`
+	ProjectID string         `envconfig:"project_id"`
+	Cluster   string         `envconfig:"cluster"`
+	Location  string         `envconfig:"location"`
+	NodePools nodePoolGroups `envconfig:"node_pools"`
+	DryRun    bool           `envconfig:"dry_run"`
+	Local     bool           `envconfig:"local"`
+	LogLevel  string         `envconfig:"log_level"`
+
+	DeleteStrategy string `envconfig:"delete_strategy"`
+
+	PushgatewayURL string `envconfig:"pushgateway_url"`
+
+	Daemon     bool          `envconfig:"daemon"`
+	Interval   time.Duration `envconfig:"interval"`
+	Schedule   string        `envconfig:"schedule"`
+	ListenAddr string        `envconfig:"listen_addr"`
+
+	LeaderElect    bool   `envconfig:"leader_elect"`
+	LeaseNamespace string `envconfig:"lease_namespace"`
+}
+
+// nodePoolGroups represents node-pool groups separated by ";", and node-pools
+// in a group are separated by "+" or ",".
+// e.g. "web-ondemand+web-preemptible;batch-ondemand+batch-preemptible"
+type nodePoolGroups [][]string
+
+// Decode implements envconfig.Decoder
+func (g *nodePoolGroups) Decode(value string) error {
+	groups := make([][]string, 0)
+	for _, s := range strings.Split(value, ";") {
+		group := make([]string, 0)
+		for _, pool := range strings.FieldsFunc(s, func(r rune) bool { return r == '+' || r == ',' }) {
+			if pool = strings.TrimSpace(pool); pool != "" {
+				group = append(group, pool)
+			}
+		}
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	*g = groups
+	return nil
+}
+
+// loadConfig returns the config file overridden by the environments.
+func loadConfig(e Env) (*thyella.Config, error) {
+	c := thyella.DefaultConfig()
+	if e.Config != "" {
+		var err error
+		c, err = thyella.LoadConfig(e.Config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.ProjectID != "" {
+		c.ProjectID = e.ProjectID
+	}
+	if e.Cluster != "" {
+		c.Cluster = e.Cluster
+	}
+	if e.Location != "" {
+		c.Location = e.Location
+	}
+	if len(e.NodePools) > 0 {
+		c.NodePoolGroups = e.NodePools
+	}
+	if e.DryRun {
+		c.DryRun = true
+	}
+	if e.Local && c.Kubeconfig == "" {
+		c.Kubeconfig = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	}
+	if e.LogLevel != "" {
+		c.LogLevel = e.LogLevel
+	}
+	if e.DeleteStrategy != "" {
+		c.DeleteStrategy = thyella.DeleteStrategy(e.DeleteStrategy)
+	}
+	if e.PushgatewayURL != "" {
+		c.PushgatewayURL = e.PushgatewayURL
+	}
+	if e.Daemon {
+		c.Daemon.Enabled = true
+	}
+	if e.Interval > 0 || e.Schedule != "" {
+		c.Daemon.Interval.Duration = e.Interval
+		c.Daemon.Schedule = e.Schedule
+	}
+	if e.ListenAddr != "" {
+		c.Daemon.ListenAddr = e.ListenAddr
+	}
+	if e.LeaderElect {
+		c.Daemon.LeaderElection.Enabled = true
+	}
+	if e.LeaseNamespace != "" {
+		c.Daemon.LeaderElection.Namespace = e.LeaseNamespace
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 func main() {
@@ -18,21 +130,139 @@ func main() {
 	if err := envconfig.Process("thyella", &e); err != nil {
 		log.Fatal(err)
 	}
-
-	kaasClient, err := thyella.NewGKEClient(e.ProjectID)
+	conf, err := loadConfig(e)
 	if err != nil {
 		log.Fatal(err)
 	}
-	k8sClient, err := thyella.NewK8sClient()
+	logger, err := thyella.NewLogger(conf.LogLevel)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer logger.Sync()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		s := <-sig
+		logger.Info("received signal", zap.Stringer("signal", s))
+		cancel()
+	}()
+
+	gkeClient, err := thyella.NewGKEClient(conf.ProjectID, conf.Location, logger)
+	if err != nil {
+		logger.Fatal("failed to create GKE client", zap.Error(err))
+	}
+	defer gkeClient.Close()
+	var kaasClient thyella.KaasProvider = gkeClient
+	if s := conf.DeleteStrategy; s == thyella.DeleteStrategyRecreate || s == thyella.DeleteStrategyDelete {
+		kaasClient, err = thyella.NewMIGClient(gkeClient, conf.DeleteStrategy)
+		if err != nil {
+			logger.Fatal("failed to create MIG client", zap.Error(err))
+		}
+	}
+	var k8sClient thyella.K8sAccessor
+	if conf.Daemon.Enabled {
+		// keep nodes and pods in the informer cache instead of listing every run.
+		k8sClient, err = thyella.NewCachedK8sClient(context.Background(), conf.Kubeconfig, conf.Drain, conf.NodeLabels, conf.NodePoolNames(), logger)
+	} else {
+		k8sClient, err = thyella.NewK8sClient(conf.Kubeconfig, conf.Drain, conf.NodeLabels, conf.NodePoolNames(), logger)
+	}
+	if err != nil {
+		logger.Fatal("failed to create Kubernetes client", zap.Error(err))
+	}
 
 	p := thyella.Thyella{
 		KaasClient: kaasClient,
 		K8sClient:  k8sClient,
+		Config:     conf,
+		Logger:     logger,
 	}
-	if err := p.Purge(e.Cluster, e.NodePools); err != nil {
-		log.Fatal(err)
+
+	if conf.Daemon.Enabled {
+		runDaemon(ctx, p, conf)
+		closeK8sClient(logger, k8sClient)
+		return
+	}
+
+	if conf.DryRun {
+		plans, err := p.Plan(ctx, conf.Cluster, conf.NodePoolGroups)
+		if plans != nil {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(plans); err != nil {
+				logger.Fatal("failed to encode plans", zap.Error(err))
+			}
+		}
+		if err != nil {
+			logger.Fatal("failed to plan", zap.Error(err))
+		}
+		return
+	}
+
+	_, err = p.Purge(ctx, conf.Cluster, conf.NodePoolGroups)
+	// flush the events before exiting, logger.Fatal skips deferred calls
+	closeK8sClient(logger, k8sClient)
+	if conf.PushgatewayURL != "" {
+		if err := thyella.PushMetrics(conf.PushgatewayURL, "thyella"); err != nil {
+			logger.Error("failed to push metrics", zap.Error(err))
+		}
+	}
+	if err != nil {
+		logger.Fatal("failed to purge", zap.Error(err))
+	}
+}
+
+// closeK8sClient flushes the events recorded by the client.
+func closeK8sClient(logger *zap.Logger, c thyella.K8sAccessor) {
+	if err := c.Close(); err != nil {
+		logger.Warn("failed to close Kubernetes client", zap.Error(err))
+	}
+}
+
+func runDaemon(ctx context.Context, p thyella.Thyella, conf *thyella.Config) {
+	logger := p.Logger
+	schedule, err := thyella.NewSchedule(conf.Daemon.Interval.Duration, conf.Daemon.Schedule)
+	if err != nil {
+		logger.Fatal("invalid schedule", zap.Error(err))
+	}
+	d := &thyella.Daemon{
+		Thyella:         p,
+		Cluster:         conf.Cluster,
+		Groups:          conf.NodePoolGroups,
+		Schedule:        schedule,
+		ShutdownTimeout: conf.Daemon.ShutdownTimeout.Duration,
+	}
+
+	srv := &http.Server{
+		Addr:    conf.Daemon.ListenAddr,
+		Handler: d.Handler(),
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("failed to serve", zap.Error(err))
+		}
+	}()
+
+	if le := conf.Daemon.LeaderElection; le.Enabled {
+		lock, err := thyella.NewLeaseLock(conf.Kubeconfig, le.Namespace, le.Name)
+		if err != nil {
+			logger.Fatal("failed to create lease lock", zap.Error(err))
+		}
+		err = d.RunWithLeaderElection(ctx, lock, le)
+		if err != nil {
+			// exit to rejoin the election after restart.
+			closeK8sClient(logger, p.K8sClient)
+			logger.Fatal("failed to run leader election", zap.Error(err))
+		}
+	} else if err := d.Run(ctx); err != nil {
+		logger.Error("failed to run daemon", zap.Error(err))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shutdown server", zap.Error(err))
 	}
 }
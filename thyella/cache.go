@@ -0,0 +1,88 @@
+package thyella
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const podNodeNameIndex = "spec.nodeName"
+
+// NewCachedK8sClient returns K8sClient serving nodes and pods from the
+// informer cache, which is maintained until ctx is done. Only nodes
+// belonging to the node-pools are watched.
+func NewCachedK8sClient(ctx context.Context, kubeconfig string, opts DrainOptions, keys NodeLabels, pools []string, logger *zap.Logger) (K8sAccessor, error) {
+	config, err := getRestConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return newCachedK8sClient(ctx, cs, opts, keys, pools, logger)
+}
+
+func newCachedK8sClient(ctx context.Context, cs kubernetes.Interface, opts DrainOptions, keys NodeLabels, pools []string, logger *zap.Logger) (K8sClient, error) {
+	selector, err := nodePoolSelector(keys.NodePool, pools)
+	if err != nil {
+		return K8sClient{}, err
+	}
+
+	nodeInformer := coreinformers.NewFilteredNodeInformer(cs, 0, cache.Indexers{}, func(o *metav1.ListOptions) {
+		o.LabelSelector = selector.String()
+	})
+	podInformer := coreinformers.NewPodInformer(cs, metav1.NamespaceAll, 0, cache.Indexers{
+		podNodeNameIndex: func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*corev1.Pod)
+			if !ok || pod.Spec.NodeName == "" {
+				return []string{}, nil
+			}
+			return []string{pod.Spec.NodeName}, nil
+		},
+	})
+	go nodeInformer.Run(ctx.Done())
+	go podInformer.Run(ctx.Done())
+
+	syncCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), nodeInformer.HasSynced, podInformer.HasSynced) {
+		return K8sClient{}, fmt.Errorf("failed to sync the informer cache")
+	}
+
+	broadcaster, recorder := newEventRecorder(cs)
+	return K8sClient{
+		clientset:    cs,
+		drainOptions: opts,
+		nodeLabels:   keys,
+		pools:        pools,
+		broadcaster:  broadcaster,
+		recorder:     recorder,
+		logger:       logger,
+		nodeLister:   corelisters.NewNodeLister(nodeInformer.GetIndexer()),
+		podIndexer:   podInformer.GetIndexer(),
+	}, nil
+}
+
+// nodePoolSelector returns the label selector matching nodes belonging to
+// the node-pools.
+func nodePoolSelector(key string, pools []string) (labels.Selector, error) {
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("node-pools are required to watch nodes")
+	}
+	req, err := labels.NewRequirement(key, selection.In, pools)
+	if err != nil {
+		return nil, err
+	}
+	return labels.NewSelector().Add(*req), nil
+}
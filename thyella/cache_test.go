@@ -0,0 +1,60 @@
+package thyella
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCachedK8sClient(t *testing.T) {
+	poolNode := func(name, pool string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{gkeNodePoolLabel: pool},
+			},
+		}
+	}
+	cs := fake.NewSimpleClientset(
+		poolNode("na", "pa"),
+		poolNode("nb", "pb"),
+		poolNode("nc", "pc"),
+		newPod("pa", "1"),
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pb", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "nb"},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k8s, err := newCachedK8sClient(ctx, cs, DefaultDrainOptions(), DefaultNodeLabels(), []string{"pa", "pb"}, zap.NewNop())
+	assert.NoError(t, err)
+
+	nodes, err := k8s.GetNodeList(ctx)
+	assert.NoError(t, err)
+	names := make([]string, 0)
+	for _, n := range nodes {
+		names = append(names, n.Name)
+	}
+	assert.ElementsMatch(t, []string{"na", "nb"}, names)
+
+	pods, err := k8s.listPods("na")
+	assert.NoError(t, err)
+	assert.Len(t, pods, 1)
+	assert.Equal(t, "pa", pods[0].Name)
+}
+
+func TestNodePoolSelector(t *testing.T) {
+	s, err := nodePoolSelector(gkeNodePoolLabel, []string{"pa", "pb"})
+	assert.NoError(t, err)
+	assert.Equal(t, "cloud.google.com/gke-nodepool in (pa,pb)", s.String())
+
+	_, err = nodePoolSelector(gkeNodePoolLabel, nil)
+	assert.Error(t, err)
+}
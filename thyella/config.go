@@ -0,0 +1,291 @@
+package thyella
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// Config represents settings of thyella, loaded from a YAML or JSON file
+type Config struct {
+	ProjectID  string `json:"projectID"`
+	Cluster    string `json:"cluster"`
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	DryRun     bool   `json:"dryRun,omitempty"`
+
+	// Location represents the region or zone of the cluster. Resolved by
+	// listing clusters in the project when empty.
+	Location string `json:"location,omitempty"`
+
+	// LogLevel represents the minimum level of logs, e.g. debug, info,
+	// warn and error.
+	LogLevel string `json:"logLevel,omitempty"`
+
+	// PushgatewayURL represents the Pushgateway compatible endpoint to push
+	// metrics after the run, optional.
+	PushgatewayURL string `json:"pushgatewayURL,omitempty"`
+
+	// NodePoolGroups represents node-pool groups which are processed
+	// independently. e.g. [[ondemand-pool, preemptible-pool]]
+	NodePoolGroups [][]string `json:"nodePoolGroups"`
+
+	// NodePools represents settings for each node-pool.
+	NodePools []*PoolConfig `json:"nodePools,omitempty"`
+
+	// MaxUnavailable represents the number or the percentage of nodes purged
+	// in a run across all node-pools. Unlimited when empty.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// DeleteStrategy represents how to delete the instance of the purged
+	// node, either instance(default), recreate or delete. recreate and delete
+	// go through the managed instance group of the node-pool.
+	DeleteStrategy DeleteStrategy `json:"deleteStrategy,omitempty"`
+
+	// Selection represents how to purge nodes for each capacity type, in
+	// order. Node-pools of the capacity types not listed are never purged.
+	// Defaults to DefaultSelectionRules.
+	Selection []SelectionRule `json:"selection,omitempty"`
+
+	// Drain represents the policies to evict pods.
+	Drain DrainOptions `json:"drain"`
+
+	// NodeLabels represents the label keys of the node-pool and the zone.
+	NodeLabels NodeLabels `json:"nodeLabels"`
+
+	// Maintenance represents when nodes are allowed to be purged.
+	Maintenance MaintenanceConfig `json:"maintenance"`
+
+	// Daemon represents settings for the long-running mode.
+	Daemon DaemonConfig `json:"daemon"`
+}
+
+// DaemonConfig represents settings for the long-running mode
+type DaemonConfig struct {
+	Enabled bool `json:"enabled"`
+	// Interval or Schedule(cron expression) is required when enabled.
+	Interval metav1.Duration `json:"interval,omitempty"`
+	Schedule string          `json:"schedule,omitempty"`
+	// ListenAddr serves liveness, readiness and metrics endpoints.
+	ListenAddr      string          `json:"listenAddr,omitempty"`
+	ShutdownTimeout metav1.Duration `json:"shutdownTimeout,omitempty"`
+
+	LeaderElection LeaderElectionConfig `json:"leaderElection"`
+}
+
+// LeaderElectionConfig represents settings for the Lease based leader
+// election between replicas
+type LeaderElectionConfig struct {
+	Enabled       bool            `json:"enabled"`
+	Namespace     string          `json:"namespace,omitempty"`
+	Name          string          `json:"name,omitempty"`
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+	RenewDeadline metav1.Duration `json:"renewDeadline,omitempty"`
+	RetryPeriod   metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+// DefaultConfig returns the config filled with default values
+func DefaultConfig() *Config {
+	return &Config{
+		LogLevel:       "info",
+		DeleteStrategy: DeleteStrategyInstance,
+		Drain:          DefaultDrainOptions(),
+		NodeLabels:     DefaultNodeLabels(),
+		Daemon: DaemonConfig{
+			ListenAddr:      ":8080",
+			ShutdownTimeout: metav1.Duration{Duration: 5 * time.Minute},
+			LeaderElection: LeaderElectionConfig{
+				Namespace:     "default",
+				Name:          "thyella",
+				LeaseDuration: metav1.Duration{Duration: 15 * time.Second},
+				RenewDeadline: metav1.Duration{Duration: 10 * time.Second},
+				RetryPeriod:   metav1.Duration{Duration: 2 * time.Second},
+			},
+		},
+	}
+}
+
+// PoolConfig represents settings for a node-pool
+type PoolConfig struct {
+	Name         string   `json:"name"`
+	ExcludeNodes []string `json:"excludeNodes,omitempty"`
+
+	// DrainTimeout represents the timeout of draining a node, including to
+	// wait for pods to terminate. Defaults to the longest
+	// terminationGracePeriodSeconds of pods on the node.
+	DrainTimeout metav1.Duration `json:"drainTimeout,omitempty"`
+
+	// MinAge represents the minimum age of the purgeable node, to avoid
+	// churning fresh nodes.
+	MinAge metav1.Duration `json:"minAge,omitempty"`
+
+	// ReplacementTimeout enables to wait until the node-pool gets back the
+	// ready nodes and RUNNING status after the purge. Disabled when zero.
+	ReplacementTimeout metav1.Duration `json:"replacementTimeout,omitempty"`
+
+	// MaxUnavailable represents the number or the percentage of nodes purged
+	// in the node-pool in a run. Defaults to 1.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// LoadConfig returns the config loaded from the YAML or JSON file.
+// Unknown fields are treated as an error.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	c := DefaultConfig()
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %s %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate returns an error when the config is invalid.
+func (c *Config) Validate() error {
+	if c.ProjectID == "" {
+		return fmt.Errorf("projectID is required")
+	}
+	if c.Cluster == "" {
+		return fmt.Errorf("cluster is required")
+	}
+	if _, err := NewLogger(c.LogLevel); err != nil {
+		return err
+	}
+	switch c.DeleteStrategy {
+	case "", DeleteStrategyInstance, DeleteStrategyRecreate, DeleteStrategyDelete:
+	default:
+		return fmt.Errorf("unknown deleteStrategy: %s", c.DeleteStrategy)
+	}
+	if c.NodeLabels.NodePool == "" {
+		return fmt.Errorf("nodeLabels.nodePool is required")
+	}
+	if len(c.NodePoolGroups) == 0 {
+		return fmt.Errorf("nodePoolGroups is required")
+	}
+
+	grouped := make(map[string]bool)
+	for i, group := range c.NodePoolGroups {
+		if len(group) == 0 {
+			return fmt.Errorf("nodePoolGroups[%d] is empty", i)
+		}
+		for _, pool := range group {
+			if pool == "" {
+				return fmt.Errorf("nodePoolGroups[%d] contains an empty node-pool name", i)
+			}
+			if grouped[pool] {
+				return fmt.Errorf("node-pool(%s) belongs to multiple groups", pool)
+			}
+			grouped[pool] = true
+		}
+	}
+
+	if err := validateBudget(c.MaxUnavailable); err != nil {
+		return fmt.Errorf("invalid maxUnavailable: %w", err)
+	}
+	if err := validateSelectionRules(c.Selection); err != nil {
+		return fmt.Errorf("invalid selection: %w", err)
+	}
+	if err := c.Maintenance.Validate(); err != nil {
+		return fmt.Errorf("invalid maintenance: %w", err)
+	}
+
+	if c.Daemon.Enabled {
+		if _, err := NewSchedule(c.Daemon.Interval.Duration, c.Daemon.Schedule); err != nil {
+			return fmt.Errorf("invalid daemon schedule: %w", err)
+		}
+		if c.Daemon.ShutdownTimeout.Duration < 0 {
+			return fmt.Errorf("daemon.shutdownTimeout must not be negative")
+		}
+	}
+	if le := c.Daemon.LeaderElection; le.Enabled {
+		if !c.Daemon.Enabled {
+			return fmt.Errorf("daemon.leaderElection requires daemon.enabled")
+		}
+		if le.Namespace == "" || le.Name == "" {
+			return fmt.Errorf("daemon.leaderElection.namespace and name are required")
+		}
+		if le.LeaseDuration.Duration <= le.RenewDeadline.Duration {
+			return fmt.Errorf("daemon.leaderElection.leaseDuration must be greater than renewDeadline")
+		}
+		if le.RetryPeriod.Duration <= 0 {
+			return fmt.Errorf("daemon.leaderElection.retryPeriod must be positive")
+		}
+	}
+
+	configured := make(map[string]bool)
+	for i, pc := range c.NodePools {
+		if pc == nil || pc.Name == "" {
+			return fmt.Errorf("nodePools[%d].name is required", i)
+		}
+		if configured[pc.Name] {
+			return fmt.Errorf("node-pool(%s) is configured multiple times", pc.Name)
+		}
+		configured[pc.Name] = true
+
+		if !grouped[pc.Name] {
+			return fmt.Errorf("node-pool(%s) does not belong to any nodePoolGroups", pc.Name)
+		}
+		if pc.DrainTimeout.Duration < 0 {
+			return fmt.Errorf("nodePools[%s].drainTimeout must not be negative", pc.Name)
+		}
+		if pc.MinAge.Duration < 0 {
+			return fmt.Errorf("nodePools[%s].minAge must not be negative", pc.Name)
+		}
+		if pc.ReplacementTimeout.Duration < 0 {
+			return fmt.Errorf("nodePools[%s].replacementTimeout must not be negative", pc.Name)
+		}
+		// the managed instance group never creates the replacement
+		if pc.ReplacementTimeout.Duration > 0 && c.DeleteStrategy == DeleteStrategyDelete {
+			return fmt.Errorf("nodePools[%s].replacementTimeout is not available with deleteStrategy: %s", pc.Name, DeleteStrategyDelete)
+		}
+		if err := validateBudget(pc.MaxUnavailable); err != nil {
+			return fmt.Errorf("invalid nodePools[%s].maxUnavailable: %w", pc.Name, err)
+		}
+	}
+	return nil
+}
+
+// NodePoolNames returns all node-pool names in the groups.
+func (c *Config) NodePoolNames() []string {
+	ret := make([]string, 0)
+	for _, group := range c.NodePoolGroups {
+		ret = append(ret, group...)
+	}
+	return ret
+}
+
+// maintenance returns the maintenance settings, always allowed when nil.
+func (c *Config) maintenance() MaintenanceConfig {
+	if c == nil {
+		return MaintenanceConfig{}
+	}
+	return c.Maintenance
+}
+
+// selectionRules returns the configured rules, or the default rules.
+func (c *Config) selectionRules() []SelectionRule {
+	if c == nil || len(c.Selection) == 0 {
+		return DefaultSelectionRules()
+	}
+	return c.Selection
+}
+
+// PoolConfig returns the settings for the node-pool.
+// It returns the zero value when the node-pool is not configured.
+func (c *Config) PoolConfig(name string) PoolConfig {
+	if c == nil {
+		return PoolConfig{Name: name}
+	}
+	for _, pc := range c.NodePools {
+		if pc.Name == name {
+			return *pc
+		}
+	}
+	return PoolConfig{Name: name}
+}
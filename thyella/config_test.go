@@ -0,0 +1,160 @@
+package thyella
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestLoadConfig(t *testing.T) {
+	c, err := LoadConfig("testdata/config.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, c.Validate())
+
+	assert.Equal(t, "myproject", c.ProjectID)
+	assert.Equal(t, "asia-northeast1", c.Location)
+	assert.Equal(t, [][]string{
+		{"web-ondemand", "web-preemptible"},
+		{"batch-ondemand", "batch-preemptible"},
+	}, c.NodePoolGroups)
+	assert.Equal(t, 10*time.Minute, c.PoolConfig("web-ondemand").DrainTimeout.Duration)
+	assert.Equal(t, 15*time.Minute, c.PoolConfig("web-ondemand").ReplacementTimeout.Duration)
+	assert.Equal(t, intstr.FromInt(2), *c.PoolConfig("web-ondemand").MaxUnavailable)
+	assert.Equal(t, intstr.FromString("10%"), *c.MaxUnavailable)
+	assert.Equal(t, DeleteStrategyRecreate, c.DeleteStrategy)
+	assert.Equal(t, DefaultSelectionRules(), c.Selection)
+	assert.Equal(t, "Asia/Tokyo", c.Maintenance.TimeZone)
+	assert.Equal(t, []string{"gke-mycluster-batch-preemptible-12345678-abcd"}, c.PoolConfig("batch-preemptible").ExcludeNodes)
+	assert.Equal(t, 20*time.Hour, c.PoolConfig("web-preemptible").MinAge.Duration)
+	assert.Equal(t, PoolConfig{Name: "web-ondemand-2"}, c.PoolConfig("web-ondemand-2"))
+	assert.Equal(t, DrainOptions{IgnoreDaemonSets: true, DeleteEmptyDirData: true}, c.Drain)
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thyella")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(path, []byte(`{"projectID": "p", "clustre": "c"}`), 0600)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			ProjectID:      "project",
+			Cluster:        "cluster",
+			NodePoolGroups: [][]string{{"pa", "pb"}},
+			NodePools:      []*PoolConfig{{Name: "pa"}},
+			NodeLabels:     DefaultNodeLabels(),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name:    "missing cluster",
+			modify:  func(c *Config) { c.Cluster = "" },
+			wantErr: true,
+		},
+		{
+			name:    "missing groups",
+			modify:  func(c *Config) { c.NodePoolGroups = nil },
+			wantErr: true,
+		},
+		{
+			name:    "missing node-pool label",
+			modify:  func(c *Config) { c.NodeLabels.NodePool = "" },
+			wantErr: true,
+		},
+		{
+			name:    "node-pool belongs to multiple groups",
+			modify:  func(c *Config) { c.NodePoolGroups = append(c.NodePoolGroups, []string{"pa"}) },
+			wantErr: true,
+		},
+		{
+			name:    "configured node-pool is not grouped",
+			modify:  func(c *Config) { c.NodePools = append(c.NodePools, &PoolConfig{Name: "pc"}) },
+			wantErr: true,
+		},
+		{
+			name: "invalid max unavailable",
+			modify: func(c *Config) {
+				v := intstr.FromString("120%")
+				c.NodePools[0].MaxUnavailable = &v
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicated selection rules",
+			modify: func(c *Config) {
+				c.Selection = []SelectionRule{
+					{CapacityType: CapacityTypeSpot, Strategy: SelectionOldest},
+					{CapacityType: CapacityTypeSpot, Strategy: SelectionOldestWithBalance},
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown selection strategy",
+			modify: func(c *Config) {
+				c.Selection = []SelectionRule{{CapacityType: CapacityTypeSpot, Strategy: "newest"}}
+			},
+			wantErr: true,
+		},
+		{
+			name:   "delete via managed instance group",
+			modify: func(c *Config) { c.DeleteStrategy = DeleteStrategyRecreate },
+		},
+		{
+			name: "wait for the replacement never created",
+			modify: func(c *Config) {
+				c.DeleteStrategy = DeleteStrategyDelete
+				c.NodePools[0].ReplacementTimeout = metav1.Duration{Duration: time.Minute}
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unknown delete strategy",
+			modify:  func(c *Config) { c.DeleteStrategy = "drop" },
+			wantErr: true,
+		},
+		{
+			name: "negative drain timeout",
+			modify: func(c *Config) {
+				c.NodePools[0].DrainTimeout = metav1.Duration{Duration: -time.Second}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+			err := c.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
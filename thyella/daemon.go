@@ -0,0 +1,136 @@
+package thyella
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// Daemon runs Thyella periodically while keeping clients alive
+type Daemon struct {
+	Thyella  Thyella
+	Cluster  string
+	Groups   [][]string
+	Schedule cron.Schedule
+
+	// ShutdownTimeout represents the duration to wait for the in-flight purge
+	// on shutdown. The purge is aborted and the node is uncordoned after that.
+	ShutdownTimeout time.Duration
+
+	ready int32
+}
+
+// NewSchedule returns the schedule from the interval or the cron expression.
+func NewSchedule(interval time.Duration, expr string) (cron.Schedule, error) {
+	switch {
+	case interval > 0 && expr != "":
+		return nil, fmt.Errorf("either interval or schedule must be specified")
+	case interval > 0:
+		return cron.Every(interval), nil
+	case expr != "":
+		return cron.ParseStandard(expr)
+	default:
+		return nil, fmt.Errorf("interval or schedule is required")
+	}
+}
+
+// Run runs Thyella on the schedule until ctx is done.
+func (d *Daemon) Run(ctx context.Context) error {
+	return d.run(ctx, context.Background())
+}
+
+// run runs Thyella on the schedule until ctx or abort is done.
+// The in-flight run is aborted immediately when abort is done.
+func (d *Daemon) run(ctx, abort context.Context) error {
+	if d.Schedule == nil {
+		return fmt.Errorf("schedule is required")
+	}
+
+	atomic.StoreInt32(&d.ready, 1)
+	defer atomic.StoreInt32(&d.ready, 0)
+
+	logger := d.Thyella.logger()
+	for {
+		next := d.Schedule.Next(time.Now())
+		logger.Info("scheduled next run", zap.Time("next", next))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("stopped daemon", zap.Error(ctx.Err()))
+			return nil
+		case <-abort.Done():
+			timer.Stop()
+			logger.Warn("aborted daemon", zap.Error(abort.Err()))
+			return nil
+		case <-timer.C:
+		}
+
+		d.runOnce(ctx, abort)
+	}
+}
+
+// runOnce runs Thyella once. The run continues up to ShutdownTimeout
+// even if ctx is done, to finish the in-flight purge.
+func (d *Daemon) runOnce(ctx, abort context.Context) {
+	logger := d.Thyella.logger()
+	runCtx, cancel := context.WithCancel(abort)
+	defer cancel()
+	go func() {
+		select {
+		case <-runCtx.Done():
+			return
+		case <-ctx.Done():
+		}
+
+		atomic.StoreInt32(&d.ready, 0)
+		logger.Info("shutting down, waiting for the in-flight run", zap.Duration("timeout", d.ShutdownTimeout))
+		timer := time.NewTimer(d.ShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-runCtx.Done():
+		case <-timer.C:
+			logger.Warn("aborting the in-flight run")
+			cancel()
+		}
+	}()
+
+	if d.Thyella.Config != nil && d.Thyella.Config.DryRun {
+		plans, err := d.Thyella.Plan(runCtx, d.Cluster, d.Groups)
+		for _, plan := range plans {
+			logger.Info("planned", zap.Reflect("plan", plan))
+		}
+		if err != nil {
+			logger.Error("failed to plan", zap.Error(err))
+		}
+		return
+	}
+
+	if _, err := d.Thyella.Purge(runCtx, d.Cluster, d.Groups); err != nil {
+		logger.Error("failed to purge", zap.Error(err))
+	}
+}
+
+// Handler returns the handler serving liveness, readiness and metrics
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&d.ready) == 0 {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/metrics", MetricsHandler())
+	return mux
+}
@@ -0,0 +1,82 @@
+package thyella
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSchedule(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 30, 0, 0, time.UTC)
+
+	s, err := NewSchedule(time.Hour, "")
+	assert.NoError(t, err)
+	assert.Equal(t, base.Add(time.Hour), s.Next(base))
+
+	s, err = NewSchedule(0, "0 3 * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 1, 3, 0, 0, 0, time.UTC), s.Next(base))
+
+	_, err = NewSchedule(time.Hour, "0 3 * * *")
+	assert.Error(t, err)
+	_, err = NewSchedule(0, "")
+	assert.Error(t, err)
+	_, err = NewSchedule(0, "invalid")
+	assert.Error(t, err)
+}
+
+func TestDaemonAbortsInFlightRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	kaas := NewMockKaasProvider(ctrl)
+	k8s := NewMockK8sAccessor(ctrl)
+
+	// the in-flight run is blocked until aborted
+	k8s.EXPECT().GetNodeList(gomock.Any()).DoAndReturn(func(ctx context.Context) ([]*Node, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	d := &Daemon{
+		Thyella:         Thyella{KaasClient: kaas, K8sClient: k8s},
+		Cluster:         "cluster",
+		Groups:          [][]string{{"pa", "pb"}},
+		ShutdownTimeout: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		d.runOnce(ctx, context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the in-flight run was not aborted")
+	}
+}
+
+func TestDaemonHandler(t *testing.T) {
+	d := &Daemon{}
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+
+	for path, want := range map[string]int{
+		"/healthz": http.StatusOK,
+		"/readyz":  http.StatusServiceUnavailable,
+		"/metrics": http.StatusOK,
+	} {
+		res, err := http.Get(srv.URL + path)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, want, res.StatusCode, path)
+	}
+}
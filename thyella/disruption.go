@@ -0,0 +1,152 @@
+package thyella
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// defaultPoolBudget is the number of nodes purged in a node-pool per run
+// when maxUnavailable is not configured. Such a node-pool does not keep its
+// group purging after a purge, see exhausted.
+const defaultPoolBudget = 1
+
+// disruptionBudget tracks the nodes purged in a run against the global and
+// the per node-pool maxUnavailable.
+type disruptionBudget struct {
+	// remaining number of nodes, negative means unlimited.
+	global int
+	pools  map[string]int
+	// configured represents the node-pools configured maxUnavailable, which
+	// opt in to purge multiple nodes in a run.
+	configured map[string]bool
+
+	// purged represents the keys of the purged nodes.
+	purged map[string]bool
+}
+
+// newDisruptionBudget returns the budget calculated from the nodes at the
+// beginning of the run.
+func newDisruptionBudget(c *Config, nodes []*Node) (*disruptionBudget, error) {
+	total := 0
+	nodesEachPool := make(map[string]int)
+	for _, n := range nodes {
+		nodesEachPool[n.NodePool]++
+	}
+	if c == nil {
+		total = len(nodes)
+	} else {
+		for _, pool := range c.NodePoolNames() {
+			total += nodesEachPool[pool]
+		}
+	}
+
+	b := &disruptionBudget{
+		global:     -1,
+		pools:      make(map[string]int),
+		configured: make(map[string]bool),
+		purged:     make(map[string]bool),
+	}
+	if c != nil && c.MaxUnavailable != nil {
+		v, err := budgetValue(c.MaxUnavailable, total)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxUnavailable: %w", err)
+		}
+		b.global = v
+	}
+	for pool, cnt := range nodesEachPool {
+		b.pools[pool] = defaultPoolBudget
+		if pc := c.PoolConfig(pool); pc.MaxUnavailable != nil {
+			v, err := budgetValue(pc.MaxUnavailable, cnt)
+			if err != nil {
+				return nil, fmt.Errorf("invalid nodePools[%s].maxUnavailable: %w", pool, err)
+			}
+			b.pools[pool] = v
+			b.configured[pool] = true
+		}
+	}
+	return b, nil
+}
+
+// budgetValue returns the number of nodes of the int or percentage value.
+// The percentage is rounded down, but at least one node.
+func budgetValue(v *intstr.IntOrString, total int) (int, error) {
+	n, err := intstr.GetValueFromIntOrPercent(v, total, false)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 && v.Type == intstr.String {
+		n = 1
+	}
+	return n, nil
+}
+
+// validateBudget returns an error when the value is not a positive number
+// or a percentage in (0, 100].
+func validateBudget(v *intstr.IntOrString) error {
+	if v == nil {
+		return nil
+	}
+	if v.Type == intstr.String && !strings.HasSuffix(v.StrVal, "%") {
+		return fmt.Errorf("%q is not a percentage", v.StrVal)
+	}
+	n, err := intstr.GetValueFromIntOrPercent(v, 100, false)
+	if err != nil {
+		return err
+	}
+	if n < 1 || (v.Type == intstr.String && n > 100) {
+		return fmt.Errorf("%s is out of range", v.String())
+	}
+	return nil
+}
+
+// allowed returns whether the node in the node-pool can be purged.
+// It always returns true when the budget is nil.
+func (b *disruptionBudget) allowed(pool string) bool {
+	if b == nil {
+		return true
+	}
+	return b.global != 0 && b.pools[pool] > 0
+}
+
+// exhausted returns whether the group purges no more nodes after a purge.
+// The group keeps purging while any node-pool configured maxUnavailable in it
+// has the budget, so that a group purges one node per run by default.
+func (b *disruptionBudget) exhausted(group []string) bool {
+	if b == nil {
+		return true
+	}
+	for _, pool := range group {
+		if b.configured[pool] && b.allowed(pool) {
+			return false
+		}
+	}
+	return true
+}
+
+// consume records the purged node.
+func (b *disruptionBudget) consume(n *Node) {
+	if b == nil {
+		return
+	}
+	if b.global > 0 {
+		b.global--
+	}
+	b.pools[n.NodePool]--
+	b.purged[n.key()] = true
+}
+
+// remaining returns the nodes except purged ones in the run.
+func (b *disruptionBudget) remaining(nodes []*Node) []*Node {
+	if b == nil {
+		return nodes
+	}
+	ret := make([]*Node, 0, len(nodes))
+	for _, n := range nodes {
+		if !b.purged[n.key()] {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,211 @@
+package thyella
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestDisruptionBudget(t *testing.T) {
+	nodes := []*Node{
+		{Name: "na1", NodePool: "pa"},
+		{Name: "na2", NodePool: "pa"},
+		{Name: "na3", NodePool: "pa"},
+		{Name: "na4", NodePool: "pa"},
+		{Name: "nb1", NodePool: "pb"},
+		{Name: "nb2", NodePool: "pb"},
+		{Name: "nc1", NodePool: "pc"},
+	}
+	percent := intstr.FromString("50%")
+	three := intstr.FromInt(3)
+
+	tests := []struct {
+		name     string
+		config   *Config
+		consume  []string
+		pool     string
+		wantLeft bool
+	}{
+		{
+			name:     "a node per node-pool by default",
+			config:   &Config{NodePoolGroups: [][]string{{"pa", "pb"}}},
+			consume:  []string{"na1"},
+			pool:     "pa",
+			wantLeft: false,
+		},
+		{
+			name:     "other node-pools are not affected",
+			config:   &Config{NodePoolGroups: [][]string{{"pa", "pb"}}},
+			consume:  []string{"na1"},
+			pool:     "pb",
+			wantLeft: true,
+		},
+		{
+			name: "percentage of the node-pool",
+			config: &Config{
+				NodePoolGroups: [][]string{{"pa", "pb"}},
+				NodePools:      []*PoolConfig{{Name: "pa", MaxUnavailable: &percent}},
+			},
+			consume:  []string{"na1"},
+			pool:     "pa",
+			wantLeft: true,
+		},
+		{
+			name: "percentage of the node-pool is exhausted",
+			config: &Config{
+				NodePoolGroups: [][]string{{"pa", "pb"}},
+				NodePools:      []*PoolConfig{{Name: "pa", MaxUnavailable: &percent}},
+			},
+			consume:  []string{"na1", "na2"},
+			pool:     "pa",
+			wantLeft: false,
+		},
+		{
+			name: "global budget is exhausted",
+			config: &Config{
+				NodePoolGroups: [][]string{{"pa", "pb"}},
+				NodePools:      []*PoolConfig{{Name: "pa", MaxUnavailable: &three}},
+				// 50% of 6 nodes in the groups
+				MaxUnavailable: &percent,
+			},
+			consume:  []string{"na1", "na2", "nb1"},
+			pool:     "pa",
+			wantLeft: false,
+		},
+		{
+			name: "percentage is at least a node",
+			config: &Config{
+				NodePoolGroups: [][]string{{"pc"}},
+				NodePools:      []*PoolConfig{{Name: "pc", MaxUnavailable: &percent}},
+			},
+			pool:     "pc",
+			wantLeft: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newDisruptionBudget(tt.config, nodes)
+			assert.NoError(t, err)
+			for _, name := range tt.consume {
+				for _, n := range nodes {
+					if n.Name == name {
+						b.consume(n)
+					}
+				}
+			}
+			assert.Equal(t, tt.wantLeft, b.allowed(tt.pool))
+			assert.Len(t, b.remaining(nodes), len(nodes)-len(tt.consume))
+		})
+	}
+
+	var nilBudget *disruptionBudget
+	assert.True(t, nilBudget.allowed("pa"))
+}
+
+func TestDisruptionBudgetRemaining(t *testing.T) {
+	purged := &Node{Name: "na", UID: "ua", NodePool: "pa"}
+	// the replacement recreated by MIGs has the same name
+	recreated := &Node{Name: "na", UID: "ua2", NodePool: "pa"}
+	other := &Node{Name: "nb", UID: "ub", NodePool: "pa"}
+
+	b, err := newDisruptionBudget(nil, []*Node{purged, other})
+	assert.NoError(t, err)
+	b.consume(purged)
+	assert.Equal(t, []*Node{other}, b.remaining([]*Node{purged, other}))
+	assert.Equal(t, []*Node{recreated, other}, b.remaining([]*Node{recreated, other}))
+}
+
+func TestDisruptionBudgetExhausted(t *testing.T) {
+	nodes := []*Node{
+		{Name: "na1", NodePool: "pa"},
+		{Name: "na2", NodePool: "pa"},
+		{Name: "nb1", NodePool: "pb"},
+		{Name: "nb2", NodePool: "pb"},
+	}
+	two := intstr.FromInt(2)
+
+	tests := []struct {
+		name    string
+		config  *Config
+		consume []string
+		want    bool
+	}{
+		{
+			name:    "a node per node-pool group by default",
+			config:  &Config{NodePoolGroups: [][]string{{"pa", "pb"}}},
+			consume: []string{"na1"},
+			want:    true,
+		},
+		{
+			name: "configured node-pool keeps the group purging",
+			config: &Config{
+				NodePoolGroups: [][]string{{"pa", "pb"}},
+				NodePools:      []*PoolConfig{{Name: "pb", MaxUnavailable: &two}},
+			},
+			consume: []string{"na1", "nb1"},
+			want:    false,
+		},
+		{
+			name: "configured node-pool is exhausted",
+			config: &Config{
+				NodePoolGroups: [][]string{{"pa", "pb"}},
+				NodePools:      []*PoolConfig{{Name: "pb", MaxUnavailable: &two}},
+			},
+			consume: []string{"nb1", "nb2"},
+			want:    true,
+		},
+		{
+			name: "global budget alone does not opt in",
+			config: &Config{
+				NodePoolGroups: [][]string{{"pa", "pb"}},
+				MaxUnavailable: &two,
+			},
+			consume: []string{"na1"},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newDisruptionBudget(tt.config, nodes)
+			assert.NoError(t, err)
+			for _, name := range tt.consume {
+				for _, n := range nodes {
+					if n.Name == name {
+						b.consume(n)
+					}
+				}
+			}
+			assert.Equal(t, tt.want, b.exhausted([]string{"pa", "pb"}))
+		})
+	}
+}
+
+func TestValidateBudget(t *testing.T) {
+	tests := []struct {
+		value   intstr.IntOrString
+		wantErr bool
+	}{
+		{value: intstr.FromInt(1)},
+		{value: intstr.FromString("30%")},
+		{value: intstr.FromString("100%")},
+		{value: intstr.FromInt(0), wantErr: true},
+		{value: intstr.FromString("0%"), wantErr: true},
+		{value: intstr.FromString("120%"), wantErr: true},
+		{value: intstr.FromString("3"), wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.value.String(), func(t *testing.T) {
+			err := validateBudget(&tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+	assert.NoError(t, validateBudget(nil))
+}
@@ -0,0 +1,99 @@
+package thyella
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DrainOptions represents the policies to evict pods, same as `kubectl drain`
+type DrainOptions struct {
+	// IgnoreDaemonSets skips DaemonSet-managed pods, otherwise the drain fails.
+	IgnoreDaemonSets bool `json:"ignoreDaemonSets"`
+	// DeleteEmptyDirData evicts pods using emptyDir, otherwise the drain fails.
+	DeleteEmptyDirData bool `json:"deleteEmptyDirData"`
+	// Force evicts pods not managed by a controller, otherwise the drain fails.
+	Force bool `json:"force"`
+}
+
+// DefaultDrainOptions returns the options compatible with evicting all pods
+// except DaemonSet-managed, mirror and terminated pods.
+func DefaultDrainOptions() DrainOptions {
+	return DrainOptions{
+		IgnoreDaemonSets:   true,
+		DeleteEmptyDirData: true,
+		Force:              true,
+	}
+}
+
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// reasons why pods block the drain
+const (
+	blockedDaemonSet    = "DaemonSet-managed pods (use ignoreDaemonSets)"
+	blockedUnmanaged    = "pods not managed by a controller (use force)"
+	blockedLocalStorage = "pods with local storage (use deleteEmptyDirData)"
+)
+
+// filterPods returns the pods to be evicted.
+// It returns an error listing the pods which block the drain.
+func filterPods(pods []corev1.Pod, opts DrainOptions, logger *zap.Logger) ([]corev1.Pod, error) {
+	ret := make([]corev1.Pod, 0, len(pods))
+	blocked := make(map[string][]string)
+	for _, pod := range pods {
+		name := pod.Namespace + "/" + pod.Name
+
+		// static pods cannot be evicted, kubelet manages them.
+		if _, ok := pod.GetAnnotations()[mirrorPodAnnotation]; ok {
+			logger.Debug("skipped mirror pod", zap.String("pod", name))
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			logger.Debug("skipped terminated pod", zap.String("pod", name))
+			continue
+		}
+
+		ref := metav1.GetControllerOf(&pod)
+		switch {
+		case ref != nil && ref.Kind == "DaemonSet":
+			if !opts.IgnoreDaemonSets {
+				blocked[blockedDaemonSet] = append(blocked[blockedDaemonSet], name)
+				continue
+			}
+			// DaemonSet controller ignores unschedulable flag, so the pod
+			// would be rescheduled onto the cordoned node immediately.
+			logger.Debug("skipped DaemonSet-managed pod", zap.String("pod", name))
+			continue
+		case ref == nil && !opts.Force:
+			blocked[blockedUnmanaged] = append(blocked[blockedUnmanaged], name)
+			continue
+		case hasLocalStorage(pod) && !opts.DeleteEmptyDirData:
+			blocked[blockedLocalStorage] = append(blocked[blockedLocalStorage], name)
+			continue
+		}
+		ret = append(ret, pod)
+	}
+
+	if len(blocked) > 0 {
+		msgs := make([]string, 0, len(blocked))
+		for _, reason := range []string{blockedDaemonSet, blockedUnmanaged, blockedLocalStorage} {
+			if names, ok := blocked[reason]; ok {
+				msgs = append(msgs, fmt.Sprintf("%s: [%s]", reason, strings.Join(names, ",")))
+			}
+		}
+		return nil, fmt.Errorf("cannot evict %s", strings.Join(msgs, "; "))
+	}
+	return ret, nil
+}
+
+func hasLocalStorage(pod corev1.Pod) bool {
+	for _, v := range pod.Spec.Volumes {
+		if v.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package thyella
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFilterPods(t *testing.T) {
+	controller := true
+	managed := func(name, kind string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				OwnerReferences: []metav1.OwnerReference{{Kind: kind, Name: "owner", Controller: &controller}},
+			},
+		}
+	}
+
+	var (
+		replica    = managed("replica", "ReplicaSet")
+		daemon     = managed("daemon", "DaemonSet")
+		unmanaged  = corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: "default"}}
+		mirror     = corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "mirror", Namespace: "kube-system", Annotations: map[string]string{mirrorPodAnnotation: "x"}}}
+		terminated = managed("terminated", "Job")
+		emptyDir   = managed("emptydir", "ReplicaSet")
+	)
+	terminated.Status.Phase = corev1.PodSucceeded
+	emptyDir.Spec.Volumes = []corev1.Volume{{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+
+	tests := []struct {
+		name    string
+		pods    []corev1.Pod
+		opts    DrainOptions
+		want    []corev1.Pod
+		wantErr string
+	}{
+		{
+			name: "should skip DaemonSet, mirror and terminated pods",
+			pods: []corev1.Pod{replica, daemon, mirror, terminated, unmanaged, emptyDir},
+			opts: DefaultDrainOptions(),
+			want: []corev1.Pod{replica, unmanaged, emptyDir},
+		},
+		{
+			name:    "should fail with DaemonSet-managed pods",
+			pods:    []corev1.Pod{replica, daemon},
+			opts:    DrainOptions{Force: true, DeleteEmptyDirData: true},
+			wantErr: "cannot evict DaemonSet-managed pods (use ignoreDaemonSets): [default/daemon]",
+		},
+		{
+			name:    "should fail with unmanaged pods and local storage",
+			pods:    []corev1.Pod{replica, unmanaged, emptyDir},
+			opts:    DrainOptions{IgnoreDaemonSets: true},
+			wantErr: "cannot evict pods not managed by a controller (use force): [default/unmanaged]; pods with local storage (use deleteEmptyDirData): [default/emptydir]",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filterPods(tt.pods, tt.opts, zap.NewNop())
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
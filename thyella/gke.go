@@ -2,13 +2,20 @@ package thyella
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	container "cloud.google.com/go/container/apiv1"
-	"github.com/K0kubun/pp"
+	"go.uber.org/zap"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	containerpb "google.golang.org/genproto/googleapis/container/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 //go:generate mockgen --package $GOPACKAGE -source $GOFILE -destination mock_$GOFILE
@@ -16,33 +23,72 @@ import (
 // KaasProvider wrapped GKE client
 type KaasProvider interface {
 	GetNodePool(ctx context.Context, clusterName, poolName string, nodes []*Node) (*NodePool, error)
-	DeleteInstance(ctx context.Context, clusterName string, node *Node) error
+	DeleteInstance(ctx context.Context, clusterName string, node *Node) (*InstanceState, error)
+}
+
+// statuses of the instance not reported by the compute API
+const (
+	InstanceStatusDeleted = "DELETED"
+	InstanceStatusUnknown = "UNKNOWN"
+)
+
+// InstanceState represents the final state of the deleted instance
+type InstanceState struct {
+	Node            string `json:"node"`
+	Operation       string `json:"operation"`
+	OperationStatus string `json:"operationStatus"`
+	// Status represents the status of the instance after the operation,
+	// DELETED when it is not found, e.g. PROVISIONING when it is recreated.
+	Status string `json:"status"`
 }
 
 // GKEClient gke client
 type GKEClient struct {
 	project string
 	client  *container.ClusterManagerClient
+	compute *compute.Service
+	logger  *zap.Logger
+
+	// location is the configured location of the cluster, optional.
+	location string
+	// locations caches the resolved locations by cluster names.
+	mu        sync.Mutex
+	locations map[string]string
 }
 
-// NewGKEClient returns initialized GKEClient
-func NewGKEClient(project string) (*GKEClient, error) {
-	cli, err := container.NewClusterManagerClient(context.Background())
+// NewGKEClient returns initialized GKEClient. The location of the cluster is
+// resolved by listing clusters when it is empty.
+func NewGKEClient(project, location string, logger *zap.Logger) (*GKEClient, error) {
+	ctx := context.Background()
+	cli, err := container.NewClusterManagerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newComputeService(ctx)
 	if err != nil {
+		cli.Close()
 		return nil, err
 	}
 
 	return &GKEClient{
-		project: project,
-		client:  cli,
+		project:   project,
+		client:    cli,
+		compute:   c,
+		logger:    logger,
+		location:  location,
+		locations: make(map[string]string),
 	}, nil
 }
 
+// Close releases the connection of the cluster manager client.
+func (gke *GKEClient) Close() error {
+	return gke.client.Close()
+}
+
 // GetNodePool returns node-pool
-func (gke GKEClient) GetNodePool(ctx context.Context, clusterName, poolName string, nodes []*Node) (*NodePool, error) {
-	location, err := gke.getClusterLocation(ctx, gke.project, clusterName)
+func (gke *GKEClient) GetNodePool(ctx context.Context, clusterName, poolName string, nodes []*Node) (*NodePool, error) {
+	location, err := gke.clusterLocation(ctx, clusterName)
 	if err != nil {
-		pp.Println("4")
 		return nil, err
 	}
 
@@ -54,38 +100,195 @@ func (gke GKEClient) GetNodePool(ctx context.Context, clusterName, poolName stri
 	}
 	res, err := gke.client.GetNodePool(ctx, req)
 	if err != nil {
-		pp.Println("5")
-		return nil, err
+		return nil, fmt.Errorf("failed to get node-pool: %s %w", poolName, observeAPIError(apiGKE, "get_node_pool", err))
 	}
 
+	return newNodePool(poolName, res, nodes), nil
+}
+
+// newNodePool returns the node-pool of the container API related to the
+// nodes.
+func newNodePool(name string, res *containerpb.NodePool, nodes []*Node) *NodePool {
+	as := res.GetAutoscaling()
 	ret := &NodePool{
-		Name:         poolName,
-		Autoscale:    res.GetAutoscaling().Enabled,
-		MinNodeCount: int(res.GetAutoscaling().MinNodeCount),
-		ZoneURLs:     res.GetInstanceGroupUrls(),
-		Preemptible:  res.GetConfig().Preemptible,
-		Status:       res.GetStatus().String(),
+		Name:              name,
+		Autoscale:         as.GetEnabled(),
+		MinNodeCount:      int(as.GetMinNodeCount()),
+		MaxNodeCount:      int(as.GetMaxNodeCount()),
+		TotalMinNodeCount: int(as.GetTotalMinNodeCount()),
+		TotalMaxNodeCount: int(as.GetTotalMaxNodeCount()),
+		InitialNodeCount:  int(res.GetInitialNodeCount()),
+		ZoneURLs:          res.GetInstanceGroupUrls(),
+		Preemptible:       res.GetConfig().GetPreemptible(),
+		Status:            res.GetStatus().String(),
+	}
+	if p := as.GetLocationPolicy(); p != containerpb.NodePoolAutoscaling_LOCATION_POLICY_UNSPECIFIED {
+		ret.LocationPolicy = p.String()
+	}
+	if res.GetConfig().GetSpot() {
+		ret.CapacityType = CapacityTypeSpot
 	}
 	ret.Nodes = ret.relateNodes(nodes)
-	return ret, nil
+	// the node label marks Spot VMs as well.
+	for _, n := range ret.Nodes {
+		if n.Spot {
+			ret.CapacityType = CapacityTypeSpot
+			break
+		}
+	}
+	return ret
+}
+
+// DeleteInstance delete GCE instance, and returns the final state.
+func (gke *GKEClient) DeleteInstance(ctx context.Context, clusterName string, node *Node) (*InstanceState, error) {
+	if node.Zone == "" {
+		return nil, fmt.Errorf("unknown zone of the node: %s", node.Name)
+	}
+	return gke.deleteInstance(ctx, gke.compute, node)
 }
 
-// DeleteInstance delete GCE instance.
-func (gke GKEClient) DeleteInstance(ctx context.Context, clusterName string, node *Node) error {
+func newComputeService(ctx context.Context) (*compute.Service, error) {
 	gCli, err := google.DefaultClient(ctx, compute.ComputeScope)
 	if err != nil {
-		return fmt.Errorf("failed to google.DefaultClient: %w", err)
+		return nil, fmt.Errorf("failed to google.DefaultClient: %w", err)
 	}
 	c, err := compute.New(gCli)
 	if err != nil {
-		return fmt.Errorf("failed to compute.New: %w", err)
+		return nil, fmt.Errorf("failed to compute.New: %w", err)
+	}
+	return c, nil
+}
+
+// deleteInstance deletes the instance and waits for the operation to be
+// done.
+func (gke *GKEClient) deleteInstance(ctx context.Context, c *compute.Service, node *Node) (*InstanceState, error) {
+	logger := loggerFrom(ctx, gke.logger).With(zap.String("phase", phaseDeleteInstance))
+
+	op, err := c.Instances.Delete(gke.project, node.Zone, node.Name).Context(ctx).Do()
+	if err != nil {
+		return nil, observeAPIError(apiGKE, "delete_instance", err)
+	}
+	logger.Info("requested to delete instance", zap.String("operation", op.Name))
+
+	op, err = gke.waitForOperation(ctx, c, node.Zone, op)
+	if err != nil {
+		return nil, err
 	}
+	state := gke.instanceState(ctx, c, node, op)
+	logger.Info("deleted instance", zap.Reflect("instance", state))
+	return state, nil
+}
 
-	_, err = c.Instances.Delete(gke.project, node.Zone, node.Name).Context(ctx).Do()
-	return err
+// instanceState returns the state of the instance after the operation.
+// The status is UNKNOWN when failed to get the instance.
+func (gke *GKEClient) instanceState(ctx context.Context, c *compute.Service, node *Node, op *compute.Operation) *InstanceState {
+	state := &InstanceState{
+		Node:            node.Name,
+		Operation:       op.Name,
+		OperationStatus: op.Status,
+		Status:          InstanceStatusUnknown,
+	}
+	inst, err := c.Instances.Get(gke.project, node.Zone, node.Name).Context(ctx).Do()
+	switch {
+	case err == nil:
+		state.Status = inst.Status
+	case isNotFound(err):
+		state.Status = InstanceStatusDeleted
+	default:
+		loggerFrom(ctx, gke.logger).Warn("failed to get instance", zap.Error(observeAPIError(apiGKE, "get_instance", err)))
+	}
+	return state
 }
 
-func (gke GKEClient) getClusterLocation(ctx context.Context, project, clusterName string) (string, error) {
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
+
+const operationStatusDone = "DONE"
+
+// operationPollInterval is the interval to get the status of the operation.
+var operationPollInterval = 5 * time.Second
+
+// defaultOperationTimeout is used when ctx has no deadline.
+const defaultOperationTimeout = 10 * time.Minute
+
+// OperationError represents the operation which failed or did not finish
+type OperationError struct {
+	Operation string
+	Status    string
+	Errors    []string
+}
+
+func (e *OperationError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("operation %s is not done: %s", e.Operation, e.Status)
+	}
+	return fmt.Sprintf("operation %s failed: %s", e.Operation, strings.Join(e.Errors, "; "))
+}
+
+// waitForOperation polls the zonal operation until it is done, and returns
+// the last operation. It returns OperationError when the operation failed or
+// did not finish until the deadline of ctx.
+func (gke *GKEClient) waitForOperation(ctx context.Context, c *compute.Service, zone string, op *compute.Operation) (*compute.Operation, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultOperationTimeout)
+		defer cancel()
+	}
+	logger := loggerFrom(ctx, gke.logger)
+
+	err := wait.PollImmediateUntil(operationPollInterval, func() (bool, error) {
+		if op.Status == operationStatusDone {
+			return true, nil
+		}
+		cur, err := c.ZoneOperations.Get(gke.project, zone, op.Name).Context(ctx).Do()
+		if err != nil {
+			// the operation keeps running, retry until the deadline
+			logger.Warn("failed to get operation, retry", zap.String("operation", op.Name), zap.Error(observeAPIError(apiGKE, "get_operation", err)))
+			return false, nil
+		}
+		op = cur
+		return op.Status == operationStatusDone, nil
+	}, ctx.Done())
+	if err != nil {
+		return op, fmt.Errorf("%w: %v", &OperationError{Operation: op.Name, Status: op.Status}, err)
+	}
+
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		opErr := &OperationError{Operation: op.Name, Status: op.Status}
+		for _, e := range op.Error.Errors {
+			opErr.Errors = append(opErr.Errors, fmt.Sprintf("%s: %s", e.Code, e.Message))
+		}
+		return op, opErr
+	}
+	return op, nil
+}
+
+// clusterLocation returns the configured location, or resolves the location
+// of the cluster once and caches it.
+func (gke *GKEClient) clusterLocation(ctx context.Context, clusterName string) (string, error) {
+	if gke.location != "" {
+		return gke.location, nil
+	}
+
+	gke.mu.Lock()
+	defer gke.mu.Unlock()
+	if loc, ok := gke.locations[clusterName]; ok {
+		return loc, nil
+	}
+	loc, err := gke.getClusterLocation(ctx, gke.project, clusterName)
+	if err != nil {
+		return "", err
+	}
+	if gke.locations == nil {
+		gke.locations = make(map[string]string)
+	}
+	gke.locations[clusterName] = loc
+	return loc, nil
+}
+
+func (gke *GKEClient) getClusterLocation(ctx context.Context, project, clusterName string) (string, error) {
 	uri := fmt.Sprintf("projects/%s/locations/-", project)
 	req := &containerpb.ListClustersRequest{
 		ProjectId: project,
@@ -93,13 +296,12 @@ func (gke GKEClient) getClusterLocation(ctx context.Context, project, clusterNam
 	}
 	res, err := gke.client.ListClusters(ctx, req)
 	if err != nil {
-		return "", err
+		return "", observeAPIError(apiGKE, "list_clusters", err)
 	}
 
-	pp.Println(res.Clusters)
-	pp.Println(clusterName)
 	for _, c := range res.Clusters {
 		if c.Name == clusterName {
+			loggerFrom(ctx, gke.logger).Debug("found cluster", zap.String("location", c.Location))
 			return c.Location, nil
 		}
 	}
@@ -0,0 +1,253 @@
+package thyella
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+)
+
+func TestDeleteInstance(t *testing.T) {
+	defer func(d time.Duration) { operationPollInterval = d }(operationPollInterval)
+	operationPollInterval = time.Millisecond
+
+	node := &Node{Name: "na", NodePool: "pa", Zone: "za"}
+
+	tests := []struct {
+		name       string
+		operations []*compute.Operation
+		timeout    time.Duration
+		wantErrs   []string
+		wantErr    bool
+	}{
+		{
+			name: "operation is done",
+			operations: []*compute.Operation{
+				{Name: "op", Status: "PENDING"},
+				{Name: "op", Status: "RUNNING"},
+				{Name: "op", Status: "DONE"},
+			},
+		},
+		{
+			name: "operation failed",
+			operations: []*compute.Operation{
+				{Name: "op", Status: "RUNNING"},
+				{Name: "op", Status: "DONE", Error: &compute.OperationError{
+					Errors: []*compute.OperationErrorErrors{{Code: "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE", Message: "in use"}},
+				}},
+			},
+			wantErrs: []string{"RESOURCE_IN_USE_BY_ANOTHER_RESOURCE: in use"},
+			wantErr:  true,
+		},
+		{
+			name: "operation is not done until the deadline",
+			operations: []*compute.Operation{
+				{Name: "op", Status: "RUNNING"},
+			},
+			timeout: 20 * time.Millisecond,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var polls int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/projects/project/zones/za/instances/na", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					http.Error(w, "not found", http.StatusNotFound)
+					return
+				}
+				assert.Equal(t, http.MethodDelete, r.Method)
+				json.NewEncoder(w).Encode(tt.operations[0])
+			})
+			mux.HandleFunc("/projects/project/zones/za/operations/op", func(w http.ResponseWriter, r *http.Request) {
+				i := int(atomic.AddInt32(&polls, 1))
+				if i >= len(tt.operations) {
+					i = len(tt.operations) - 1
+				}
+				json.NewEncoder(w).Encode(tt.operations[i])
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			c, err := compute.New(srv.Client())
+			assert.NoError(t, err)
+			c.BasePath = srv.URL + "/"
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			gke := GKEClient{project: "project"}
+			state, err := gke.deleteInstance(ctx, c, node)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				assert.Equal(t, &InstanceState{Node: "na", Operation: "op", OperationStatus: "DONE", Status: InstanceStatusDeleted}, state)
+				return
+			}
+			var opErr *OperationError
+			assert.True(t, errors.As(err, &opErr))
+			assert.Equal(t, "op", opErr.Operation)
+			assert.Equal(t, tt.wantErrs, opErr.Errors)
+		})
+	}
+}
+
+func TestClusterLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		gke  *GKEClient
+		want string
+	}{
+		{
+			name: "configured location",
+			gke:  &GKEClient{project: "project", location: "asia-northeast1"},
+			want: "asia-northeast1",
+		},
+		{
+			name: "cached location",
+			gke:  &GKEClient{project: "project", locations: map[string]string{"cluster": "asia-northeast1-a"}},
+			want: "asia-northeast1-a",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// the cluster manager client is nil, so that listing clusters panics
+			got, err := tt.gke.clusterLocation(context.Background(), "cluster")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewNodePool(t *testing.T) {
+	nodes := []*Node{
+		{Name: "na", NodePool: "pa", Zone: "za"},
+		{Name: "nb", NodePool: "pb", Zone: "za"},
+	}
+	spotNodes := []*Node{
+		{Name: "na", NodePool: "pa", Zone: "za", Spot: true},
+		{Name: "nb", NodePool: "pb", Zone: "za"},
+	}
+
+	tests := []struct {
+		name  string
+		res   *containerpb.NodePool
+		nodes []*Node
+		want  *NodePool
+	}{
+		{
+			name: "per zone limits",
+			res: &containerpb.NodePool{
+				Autoscaling:       &containerpb.NodePoolAutoscaling{Enabled: true, MinNodeCount: 1, MaxNodeCount: 3},
+				InstanceGroupUrls: []string{"url"},
+				Status:            containerpb.NodePool_RUNNING,
+			},
+			nodes: nodes,
+			want: &NodePool{
+				Name:         "pa",
+				Autoscale:    true,
+				MinNodeCount: 1,
+				MaxNodeCount: 3,
+				ZoneURLs:     []string{"url"},
+				Status:       "RUNNING",
+				Nodes:        nodes[:1],
+			},
+		},
+		{
+			name: "total limits and location policy",
+			res: &containerpb.NodePool{
+				Autoscaling: &containerpb.NodePoolAutoscaling{
+					Enabled:           true,
+					TotalMinNodeCount: 2,
+					TotalMaxNodeCount: 6,
+					LocationPolicy:    containerpb.NodePoolAutoscaling_ANY,
+				},
+				Status: containerpb.NodePool_RUNNING,
+			},
+			nodes: nodes,
+			want: &NodePool{
+				Name:              "pa",
+				Autoscale:         true,
+				TotalMinNodeCount: 2,
+				TotalMaxNodeCount: 6,
+				LocationPolicy:    LocationPolicyAny,
+				Status:            "RUNNING",
+				Nodes:             nodes[:1],
+			},
+		},
+		{
+			name: "not autoscaled",
+			res: &containerpb.NodePool{
+				InitialNodeCount: 2,
+				Config:           &containerpb.NodeConfig{Preemptible: true},
+				Status:           containerpb.NodePool_RUNNING,
+			},
+			nodes: nodes,
+			want: &NodePool{
+				Name:             "pa",
+				InitialNodeCount: 2,
+				Preemptible:      true,
+				Status:           "RUNNING",
+				Nodes:            nodes[:1],
+			},
+		},
+		{
+			name: "Spot flag of the node config",
+			res: &containerpb.NodePool{
+				Config: &containerpb.NodeConfig{Spot: true},
+				Status: containerpb.NodePool_RUNNING,
+			},
+			nodes: nodes,
+			want: &NodePool{
+				Name:         "pa",
+				CapacityType: CapacityTypeSpot,
+				Status:       "RUNNING",
+				Nodes:        nodes[:1],
+			},
+		},
+		{
+			name: "Spot label of the node",
+			res: &containerpb.NodePool{
+				Status: containerpb.NodePool_RUNNING,
+			},
+			nodes: spotNodes,
+			want: &NodePool{
+				Name:         "pa",
+				CapacityType: CapacityTypeSpot,
+				Status:       "RUNNING",
+				Nodes:        spotNodes[:1],
+			},
+		},
+		{
+			name: "no nodes of the node-pool",
+			res: &containerpb.NodePool{
+				Status: containerpb.NodePool_RUNNING,
+			},
+			nodes: spotNodes[1:],
+			want: &NodePool{
+				Name:   "pa",
+				Status: "RUNNING",
+				Nodes:  []*Node{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newNodePool("pa", tt.res, tt.nodes))
+		})
+	}
+}
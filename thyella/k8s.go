@@ -2,18 +2,31 @@ package thyella
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 
 	// kubeconfig auth via gcloud
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -21,22 +34,78 @@ import (
 
 //go:generate mockgen --package $GOPACKAGE -source $GOFILE -destination mock_$GOFILE
 
-var now = time.Now()
-
 // K8sAccessor wrapped raw k8s client
 type K8sAccessor interface {
 	GetNodeList(ctx context.Context) ([]*Node, error)
 	Purge(ctx context.Context, node *Node) error
+	Event(node *Node, eventType, reason, message string)
+	// Close flushes the recorded events, call it before exiting.
+	Close() error
 }
 
 // K8sClient k8s client
 type K8sClient struct {
-	clientset *kubernetes.Clientset
+	clientset    kubernetes.Interface
+	drainOptions DrainOptions
+	nodeLabels   NodeLabels
+	// pools limits the nodes to the node-pools, all nodes when empty.
+	pools       []string
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	logger      *zap.Logger
+
+	// listers served from the informer cache, optional.
+	nodeLister corelisters.NodeLister
+	podIndexer cache.Indexer
+}
+
+// NodeLabels represents the label keys of nodes
+type NodeLabels struct {
+	NodePool string `json:"nodePool"`
+	Zone     string `json:"zone"`
 }
 
-// NewK8sClient returns initialized K8sClient
-func NewK8sClient() (K8sAccessor, error) {
-	config, err := getRestConfig()
+// well-known label keys
+const (
+	gkeNodePoolLabel    = "cloud.google.com/gke-nodepool"
+	gkeSpotLabel        = "cloud.google.com/gke-spot"
+	zoneLabel           = "topology.kubernetes.io/zone"
+	deprecatedZoneLabel = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// annotations to opt-out of the purge
+const (
+	// excludeAnnotation on a node with "true" excludes the node.
+	excludeAnnotation = "thyella.io/exclude"
+	// doNotDisruptAnnotation on a pod with "true" excludes the node running
+	// the pod.
+	doNotDisruptAnnotation = "thyella.io/do-not-disrupt"
+)
+
+// DefaultNodeLabels returns the label keys of GKE
+func DefaultNodeLabels() NodeLabels {
+	return NodeLabels{
+		NodePool: gkeNodePoolLabel,
+		Zone:     zoneLabel,
+	}
+}
+
+// zone returns the zone of the node labels, falling back to the well-known
+// labels.
+func (keys NodeLabels) zone(nodeLabels map[string]string) string {
+	for _, key := range []string{keys.Zone, zoneLabel, deprecatedZoneLabel} {
+		if zone, ok := nodeLabels[key]; ok && key != "" {
+			return zone
+		}
+	}
+	return ""
+}
+
+// NewK8sClient returns initialized K8sClient. Only nodes belonging to the
+// node-pools are listed. It uses the in-cluster config when kubeconfig is
+// empty.
+func NewK8sClient(kubeconfig string, opts DrainOptions, keys NodeLabels, pools []string, logger *zap.Logger) (K8sAccessor, error) {
+	config, err := getRestConfig(kubeconfig)
 	if err != nil {
 		return nil, err
 	}
@@ -45,16 +114,81 @@ func NewK8sClient() (K8sAccessor, error) {
 		return nil, err
 	}
 
+	broadcaster, recorder := newEventRecorder(cs)
 	client := K8sClient{
-		clientset: cs,
+		clientset:    cs,
+		drainOptions: opts,
+		nodeLabels:   keys,
+		pools:        pools,
+		broadcaster:  broadcaster,
+		recorder:     recorder,
+		logger:       logger,
 	}
 	return client, nil
 }
 
-func getRestConfig() (*rest.Config, error) {
+// reasons of events
+const (
+	EventReasonCordoned             = "Cordoned"
+	EventReasonDrainStarted         = "DrainStarted"
+	EventReasonPodEvicted           = "PodEvicted"
+	EventReasonDrainFailed          = "DrainFailed"
+	EventReasonUncordoned           = "Uncordoned"
+	EventReasonNodeDeleted          = "NodeDeleted"
+	EventReasonInstanceDeleted      = "InstanceDeleted"
+	EventReasonInstanceDeleteFailed = "InstanceDeleteFailed"
+)
+
+const eventComponent = "thyella"
+
+// newEventRecorder returns the broadcaster sending events to the API server
+// in the background, and the recorder of it.
+func newEventRecorder(cs kubernetes.Interface) (record.EventBroadcaster, record.EventRecorder) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: cs.CoreV1().Events("")})
+	return broadcaster, broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+}
+
+// eventFlushTimeout is the time to wait for the recorded events to be sent
+// before shutting down the broadcaster.
+var eventFlushTimeout = 2 * time.Second
+
+// Close waits for the recorded events to be sent to the API server, and
+// shuts down the broadcaster.
+func (k8s K8sClient) Close() error {
+	if k8s.broadcaster == nil {
+		return nil
+	}
+	time.Sleep(eventFlushTimeout)
+	k8s.broadcaster.Shutdown()
+	return nil
+}
+
+// Event records the event on the node.
+func (k8s K8sClient) Event(node *Node, eventType, reason, message string) {
+	if k8s.recorder == nil {
+		return
+	}
+	ref := &corev1.ObjectReference{
+		Kind: "Node",
+		Name: node.Name,
+		// kubelet records events on the node with the UID of the node name
+		UID: types.UID(node.Name),
+	}
+	k8s.recorder.Event(ref, eventType, reason, message)
+}
+
+// podEvent records the event on the pod.
+func (k8s K8sClient) podEvent(pod corev1.Pod, eventType, reason, message string) {
+	if k8s.recorder == nil {
+		return
+	}
+	k8s.recorder.Event(&pod, eventType, reason, message)
+}
+
+func getRestConfig(kubeconfig string) (*rest.Config, error) {
 	// local run
-	if os.Getenv("THYELLA_LOCAL") != "" {
-		kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	if kubeconfig != "" {
 		return clientcmd.BuildConfigFromFlags("", kubeconfig)
 	}
 	return rest.InClusterConfig()
@@ -62,180 +196,508 @@ func getRestConfig() (*rest.Config, error) {
 
 // GetNodeList returns the nodes owned by the cluster
 func (k8s K8sClient) GetNodeList(ctx context.Context) ([]*Node, error) {
-	nl, err := k8s.clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	items, err := k8s.listNodes()
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
 	nodes := make([]*Node, 0)
-	for _, n := range nl.Items {
-		labels := n.GetLabels()
-		pool, ok := labels["cloud.google.com/gke-nodepool"]
+	for _, n := range items {
+		node, ok := newNode(n, now, k8s.nodeLabels)
 		if !ok {
 			continue
 		}
-		zone := labels["failure-domain.beta.kubernetes.io/zone"]
+		nodes = append(nodes, node)
+	}
 
-		ready := false
-		condNum := len(n.Status.Conditions)
-		if (condNum > 0) && (n.Status.Conditions[condNum-1].Type == "Ready") {
-			// unschedulable flag is enable while draining
-			if !n.Spec.Unschedulable {
-				ready = true
-			}
+	pods, err := k8s.doNotDisruptPods(nodes)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		n.DoNotDisruptPods = pods[n.Name]
+	}
+	return nodes, nil
+}
+
+// doNotDisruptPods returns the running pods annotated with do-not-disrupt by
+// the node names.
+func (k8s K8sClient) doNotDisruptPods(nodes []*Node) (map[string][]string, error) {
+	pods, err := k8s.listPodsOnNodes(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string][]string)
+	for _, pod := range pods {
+		if pod.Annotations[doNotDisruptAnnotation] != "true" {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
 		}
+		ret[pod.Spec.NodeName] = append(ret[pod.Spec.NodeName], pod.Namespace+"/"+pod.Name)
+	}
+	return ret, nil
+}
 
-		nodes = append(nodes, &Node{
-			Name:     n.GetName(),
-			NodePool: pool,
-			Zone:     zone,
-			Age:      now.Sub(n.GetCreationTimestamp().Time),
-			Ready:    ready,
-		})
+// newNode returns Node converted from the k8s node.
+// It returns false when the node does not belong to any node-pool.
+func newNode(n *corev1.Node, now time.Time, keys NodeLabels) (*Node, bool) {
+	nodeLabels := n.GetLabels()
+	pool, ok := nodeLabels[keys.NodePool]
+	if !ok {
+		return nil, false
 	}
+	zone := keys.zone(nodeLabels)
+
+	return &Node{
+		Name:     n.GetName(),
+		UID:      string(n.GetUID()),
+		NodePool: pool,
+		Zone:     zone,
+		Age:      now.Sub(n.GetCreationTimestamp().Time),
+		Spot:     nodeLabels[gkeSpotLabel] == "true",
+		// unschedulable flag is enable while draining
+		Ready:              isConditionTrue(n, corev1.NodeReady) && !n.Spec.Unschedulable,
+		MemoryPressure:     isConditionTrue(n, corev1.NodeMemoryPressure),
+		DiskPressure:       isConditionTrue(n, corev1.NodeDiskPressure),
+		PIDPressure:        isConditionTrue(n, corev1.NodePIDPressure),
+		NetworkUnavailable: isConditionTrue(n, corev1.NodeNetworkUnavailable),
+		Excluded:           n.GetAnnotations()[excludeAnnotation] == "true",
+	}, true
+}
 
-	return nodes, nil
+// isConditionTrue returns whether the condition of the node is True.
+// It returns false when the condition is Unknown or not reported.
+func isConditionTrue(n *corev1.Node, t corev1.NodeConditionType) bool {
+	for _, c := range n.Status.Conditions {
+		if c.Type == t {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// listNodes returns the nodes from the cache if available.
+func (k8s K8sClient) listNodes() ([]*corev1.Node, error) {
+	if k8s.nodeLister != nil {
+		return k8s.nodeLister.List(labels.Everything())
+	}
+
+	var opts metav1.ListOptions
+	if len(k8s.pools) > 0 {
+		selector, err := nodePoolSelector(k8s.nodeLabels.NodePool, k8s.pools)
+		if err != nil {
+			return nil, err
+		}
+		opts.LabelSelector = selector.String()
+	}
+	nl, err := k8s.clientset.CoreV1().Nodes().List(opts)
+	if err != nil {
+		return nil, observeAPIError(apiK8s, "list_nodes", err)
+	}
+	ret := make([]*corev1.Node, 0, len(nl.Items))
+	for i := range nl.Items {
+		ret = append(ret, &nl.Items[i])
+	}
+	return ret, nil
+}
+
+// listPods returns the pods on the node from the cache if available.
+func (k8s K8sClient) listPods(nodeName string) ([]corev1.Pod, error) {
+	if k8s.podIndexer != nil {
+		objs, err := k8s.podIndexer.ByIndex(podNodeNameIndex, nodeName)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]corev1.Pod, 0, len(objs))
+		for _, obj := range objs {
+			ret = append(ret, *obj.(*corev1.Pod))
+		}
+		return ret, nil
+	}
+
+	pods, err := k8s.clientset.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+	})
+	if err != nil {
+		return nil, observeAPIError(apiK8s, "list_pods", err)
+	}
+	return pods.Items, nil
+}
+
+// listPodsOnNodes returns the pods on the nodes. Without the cache, it lists
+// the pods of all nodes at once instead of every node.
+func (k8s K8sClient) listPodsOnNodes(nodes []*Node) ([]corev1.Pod, error) {
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	if k8s.podIndexer != nil {
+		var ret []corev1.Pod
+		for _, n := range nodes {
+			pods, err := k8s.listPods(n.Name)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, pods...)
+		}
+		return ret, nil
+	}
+
+	names := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		names[n.Name] = true
+	}
+	pl, err := k8s.clientset.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, observeAPIError(apiK8s, "list_pods", err)
+	}
+	ret := make([]corev1.Pod, 0)
+	for _, pod := range pl.Items {
+		if names[pod.Spec.NodeName] {
+			ret = append(ret, pod)
+		}
+	}
+	return ret, nil
 }
 
 // Purge drain & delete.
 func (k8s K8sClient) Purge(ctx context.Context, node *Node) error {
-	log.Printf("exec purge: %s/%s\n", node.NodePool, node.Name)
+	logger := loggerFrom(ctx, k8s.logger).With(nodeFields(node)...)
+	ctx = withLogger(ctx, logger)
+	logger.Info("exec purge")
 
-	if err := k8s.applyCordonOrUncordon(node, true); err != nil {
+	if err := k8s.applyCordonOrUncordon(ctx, node, true); err != nil {
 		return err
 	}
+	k8s.Event(node, corev1.EventTypeNormal, EventReasonCordoned, "Cordoned to purge the node")
 
+	k8s.Event(node, corev1.EventTypeNormal, EventReasonDrainStarted, "Draining the node")
 	if err := k8s.drain(ctx, node); err != nil {
-		e := fmt.Errorf("failed to drain: %w", err)
-		if err := k8s.applyCordonOrUncordon(node, false); err != nil {
-			e = fmt.Errorf("%+v: %w", e, err)
-		}
-		return e
+		k8s.Event(node, corev1.EventTypeWarning, EventReasonDrainFailed, fmt.Sprintf("Failed to drain the node: %v", err))
+		return k8s.rollback(ctx, node, fmt.Errorf("failed to drain: %w", err))
 	}
 
 	if err := k8s.delete(ctx, node); err != nil {
-		e := fmt.Errorf("failed to delete: %w", err)
-		if err := k8s.applyCordonOrUncordon(node, false); err != nil {
-			e = fmt.Errorf("%+v: %w", e, err)
-		}
-		return e
+		return k8s.rollback(ctx, node, fmt.Errorf("failed to delete: %w", err))
 	}
+	k8s.Event(node, corev1.EventTypeNormal, EventReasonNodeDeleted, "Deleted the node")
 
-	log.Printf("succeeded purge: %s/%s\n", node.NodePool, node.Name)
+	logger.Info("succeeded purge", zap.String("phase", phaseDeleteNode))
 	return nil
 }
 
+// rollback uncordons the node failed to purge, and returns the cause.
+func (k8s K8sClient) rollback(ctx context.Context, node *Node, cause error) error {
+	if err := k8s.applyCordonOrUncordon(ctx, node, false); err != nil {
+		return fmt.Errorf("%+v: %w", cause, err)
+	}
+	k8s.Event(node, corev1.EventTypeNormal, EventReasonUncordoned, "Uncordoned the node failed to purge")
+	return cause
+}
+
 const (
 	EvictionKind        = "Eviction"
 	EvictionSubresource = "pods/eviction"
 )
 
 func (k8s K8sClient) drain(ctx context.Context, node *Node) error {
-	policy, err := k8s.policyVersion()
+	start := time.Now()
+	defer func() {
+		drainDuration.WithLabelValues(node.NodePool).Observe(time.Since(start).Seconds())
+	}()
+
+	logger := loggerFrom(ctx, k8s.logger).With(zap.String("phase", phaseDrain))
+	ctx = withLogger(ctx, logger)
+
+	policy, err := k8s.evictionVersion()
 	if err != nil {
 		return err
 	}
+	if policy.Empty() {
+		logger.Warn("eviction API is unavailable, pods are deleted directly")
+	}
 
-	if err := k8s.evictPods(node, policy); err != nil {
+	evictCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		evictCtx, cancel = context.WithTimeout(ctx, defaultEvictionTimeout)
+		defer cancel()
+	}
+	pods, err := k8s.evictPods(evictCtx, node, policy)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return k8s.waitForPodsDeleted(ctx, pods)
+}
+
+const (
+	podDeletePollInterval = 5 * time.Second
+	// podDeleteTimeoutMargin is added to the longest grace period of pods
+	// when the drain timeout is not specified.
+	podDeleteTimeoutMargin = time.Minute
+)
+
+// waitForPodsDeleted waits until all pods are deleted.
+// It waits until the deadline of ctx if exists, otherwise waits for the
+// longest terminationGracePeriodSeconds of pods.
+func (k8s K8sClient) waitForPodsDeleted(ctx context.Context, pods []corev1.Pod) error {
+	if len(pods) == 0 {
+		return nil
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxGracePeriod(pods)+podDeleteTimeoutMargin)
+		defer cancel()
+	}
+
+	logger := loggerFrom(ctx, k8s.logger)
+	pending := pods
+	err := wait.PollImmediateUntil(podDeletePollInterval, func() (bool, error) {
+		remains := make([]corev1.Pod, 0)
+		for _, pod := range pending {
+			p, err := k8s.clientset.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) || (err == nil && p.GetUID() != pod.GetUID()) {
+				logger.Debug("deleted pod", zap.String("pod", pod.Namespace+"/"+pod.Name))
+				continue
+			}
+			if err != nil {
+				return false, observeAPIError(apiK8s, "get_pod", err)
+			}
+			remains = append(remains, pod)
+		}
+		pending = remains
+		return len(pending) == 0, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		names := make([]string, 0, len(pending))
+		for _, pod := range pending {
+			names = append(names, pod.Namespace+"/"+pod.Name)
+		}
+		return fmt.Errorf("timed out waiting for pods to terminate: [%s]", strings.Join(names, ","))
+	}
+	return err
+}
+
+func maxGracePeriod(pods []corev1.Pod) time.Duration {
+	var max int64 = corev1.DefaultTerminationGracePeriodSeconds
+	for _, pod := range pods {
+		if s := pod.Spec.TerminationGracePeriodSeconds; s != nil && max < *s {
+			max = *s
+		}
+	}
+	return time.Duration(max) * time.Second
 }
 
-func (k8s K8sClient) policyVersion() (string, error) {
+// evictionVersion returns the group version of the eviction API served by
+// the cluster. It returns empty when the eviction API is unavailable.
+// see. `kubectl drain`
+func (k8s K8sClient) evictionVersion() (schema.GroupVersion, error) {
 	discoveryClient := k8s.clientset.Discovery()
 	groupList, err := discoveryClient.ServerGroups()
 	if err != nil {
-		return "", err
+		return schema.GroupVersion{}, observeAPIError(apiK8s, "discovery", err)
 	}
 
 	foundPolicyGroup := false
 	var policyGroupVersion string
 	for _, group := range groupList.Groups {
-		if group.Name == "policy" {
+		if group.Name == policyv1beta1.GroupName {
 			foundPolicyGroup = true
 			policyGroupVersion = group.PreferredVersion.GroupVersion
 			break
 		}
 	}
 	if !foundPolicyGroup {
-		return "", nil
+		return schema.GroupVersion{}, nil
 	}
 
+	// the eviction is served as the subresource of the core pods.
 	resourceList, err := discoveryClient.ServerResourcesForGroupVersion("v1")
 	if err != nil {
-		return "", err
+		return schema.GroupVersion{}, observeAPIError(apiK8s, "discovery", err)
 	}
 	for _, resource := range resourceList.APIResources {
 		if resource.Name == EvictionSubresource && resource.Kind == EvictionKind {
-			return policyGroupVersion, nil
+			// the subresource declares the version of the Eviction it accepts.
+			if resource.Group != "" && resource.Version != "" {
+				return schema.GroupVersion{Group: resource.Group, Version: resource.Version}, nil
+			}
+			return schema.ParseGroupVersion(policyGroupVersion)
 		}
 	}
-	return "", nil
+	return schema.GroupVersion{}, nil
 }
 
 // applyCordonOrUncordon settings schedule flag.
 // see. `kubectl [un]cordon <node>`
-func (k8s K8sClient) applyCordonOrUncordon(node *Node, cordon bool) error {
+func (k8s K8sClient) applyCordonOrUncordon(ctx context.Context, node *Node, cordon bool) error {
 	expect := "cordon"
 	if !cordon {
 		expect = "un" + expect
 	}
+	logger := loggerFrom(ctx, k8s.logger).With(zap.String("phase", phaseCordon))
 
 	n, err := k8s.clientset.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return observeAPIError(apiK8s, "get_node", err)
 	}
 	if n.Spec.Unschedulable == cordon {
-		log.Printf("already %s: %s\n", expect, node.Name)
+		logger.Info("already " + expect)
 		return nil
 	}
 
 	n.Spec.Unschedulable = cordon
 	if _, err = k8s.clientset.CoreV1().Nodes().Update(n); err != nil {
-		return err
+		return observeAPIError(apiK8s, "update_node", err)
 	}
 
-	log.Printf("%s: %s\n", expect, node.Name)
+	logger.Info(expect)
 	return err
 }
 
-func (k8s K8sClient) evictPods(node *Node, policy string) error {
-	pods, err := k8s.clientset.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
-		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.Name}).String(),
-	})
+// evictPods evicts pods on the node, and returns the evicted pods.
+func (k8s K8sClient) evictPods(ctx context.Context, node *Node, policy schema.GroupVersion) ([]corev1.Pod, error) {
+	pods, err := k8s.listPods(node.Name)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	targets, err := filterPods(pods, k8s.drainOptions, loggerFrom(ctx, k8s.logger))
+	if err != nil {
+		return nil, err
 	}
 
-	for _, pod := range pods.Items {
-		eviction := &policyv1beta1.Eviction{
-			TypeMeta: metav1.TypeMeta{
-				APIVersion: policy,
-				Kind:       EvictionKind,
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      pod.Name,
-				Namespace: pod.Namespace,
-			},
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make([]error, 0)
+	)
+	for _, pod := range targets {
+		wg.Add(1)
+		go func(pod corev1.Pod) {
+			defer wg.Done()
+			if err := k8s.evictPod(ctx, pod, policy); err != nil {
+				loggerFrom(ctx, k8s.logger).Warn("failed to evict pod", zap.Error(err))
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+			podsEvicted.WithLabelValues(node.NodePool).Inc()
+			k8s.podEvent(pod, corev1.EventTypeNormal, EventReasonPodEvicted, fmt.Sprintf("Evicted to purge the node %s", node.Name))
+		}(pod)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to evict %d pod(s): %w", len(errs), errs[0])
+	}
+	return targets, nil
+}
+
+// errors of the eviction
+var (
+	ErrEvictionBlocked  = errors.New("eviction is blocked by PodDisruptionBudget")
+	ErrPDBMisconfigured = errors.New("PodDisruptionBudget is misconfigured, multiple budgets may select the pod")
+)
+
+// evictionBackoff represents the retry interval of evictions blocked by
+// PodDisruptionBudget.
+var evictionBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Cap:      30 * time.Second,
+	Steps:    10,
+}
+
+// defaultEvictionTimeout is used when the drain timeout is not specified.
+const defaultEvictionTimeout = 10 * time.Minute
+
+// evictPod evicts the pod, and retries while PodDisruptionBudget blocks it
+// until the deadline of ctx.
+func (k8s K8sClient) evictPod(ctx context.Context, pod corev1.Pod, policy schema.GroupVersion) error {
+	logger := loggerFrom(ctx, k8s.logger).With(zap.String("pod", pod.Namespace+"/"+pod.Name))
+	backoff := evictionBackoff
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s/%s: aborted eviction: %w", pod.Namespace, pod.Name, err)
+		}
+
+		err := k8s.evict(pod, policy)
+		switch {
+		case err == nil:
+			logger.Info("evicted pod")
+			return nil
+		case apierrors.IsNotFound(err):
+			logger.Info("already deleted pod")
+			return nil
+		case apierrors.IsTooManyRequests(err):
+			// retry below
+		case apierrors.IsInternalError(err):
+			observeAPIError(apiK8s, "evict", err)
+			return fmt.Errorf("%s/%s: %w: %v", pod.Namespace, pod.Name, ErrPDBMisconfigured, err)
+		default:
+			return fmt.Errorf("%s/%s: %w", pod.Namespace, pod.Name, observeAPIError(apiK8s, "evict", err))
 		}
-		// TODO: error handling by response code
-		if err = k8s.clientset.PolicyV1beta1().Evictions(eviction.Namespace).Evict(eviction); err != nil {
-			return fmt.Errorf("failed to evict pod: %s %w", pod.Name, err)
+
+		evictionRetries.Inc()
+		interval := backoff.Step()
+		logger.Info("eviction blocked by PodDisruptionBudget, retry", zap.Duration("interval", interval))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s/%s: %w: %v", pod.Namespace, pod.Name, ErrEvictionBlocked, ctx.Err())
+		case <-time.After(interval):
 		}
-		log.Printf("evicted pod: %s\n", pod.GetName())
 	}
-	return nil
+}
+
+// evict requests the eviction with the group version, and falls back to
+// delete the pod when the eviction API is unavailable.
+func (k8s K8sClient) evict(pod corev1.Pod, policy schema.GroupVersion) error {
+	eviction := &policyv1beta1.Eviction{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: policy.String(),
+			Kind:       EvictionKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	}
+
+	switch policy.Version {
+	case "v1":
+		// policy/v1 Eviction has the same schema as policy/v1beta1, post it
+		// via the pods client with the raw body.
+		body, err := json.Marshal(eviction)
+		if err != nil {
+			return err
+		}
+		return k8s.clientset.CoreV1().RESTClient().Post().
+			Namespace(pod.Namespace).
+			Resource("pods").
+			Name(pod.Name).
+			SubResource("eviction").
+			Body(body).
+			Do().
+			Error()
+	case "v1beta1":
+		return k8s.clientset.PolicyV1beta1().Evictions(eviction.Namespace).Evict(eviction)
+	default:
+		return k8s.clientset.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+	}
 }
 
 func (k8s K8sClient) delete(ctx context.Context, node *Node) error {
 	n, err := k8s.clientset.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return observeAPIError(apiK8s, "get_node", err)
 	}
 	if !n.Spec.Unschedulable {
 		return fmt.Errorf("detect schedulable flag, aborting delete node: %s %w", node.Name, err)
 	}
-	return k8s.clientset.CoreV1().Nodes().Delete(node.Name, &metav1.DeleteOptions{})
+	return observeAPIError(apiK8s, "delete_node", k8s.clientset.CoreV1().Nodes().Delete(node.Name, &metav1.DeleteOptions{}))
 }
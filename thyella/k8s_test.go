@@ -0,0 +1,585 @@
+package thyella
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func newPod(name string, uid types.UID) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: uid},
+		Spec:       corev1.PodSpec{NodeName: "na"},
+	}
+}
+
+func TestWaitForPodsDeleted(t *testing.T) {
+	evicted := []corev1.Pod{*newPod("pa", "1"), *newPod("pb", "2")}
+
+	tests := []struct {
+		name    string
+		objects []*corev1.Pod
+		wantErr string
+	}{
+		{
+			name: "all pods are deleted",
+		},
+		{
+			name:    "the pod is recreated with the same name",
+			objects: []*corev1.Pod{newPod("pa", "3")},
+		},
+		{
+			name:    "the pod is stuck",
+			objects: []*corev1.Pod{newPod("pb", "2")},
+			wantErr: "timed out waiting for pods to terminate: [default/pb]",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cs := fake.NewSimpleClientset()
+			for _, pod := range tt.objects {
+				_, err := cs.CoreV1().Pods(pod.Namespace).Create(pod)
+				assert.NoError(t, err)
+			}
+			k8s := K8sClient{clientset: cs}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := k8s.waitForPodsDeleted(ctx, evicted)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxGracePeriod(t *testing.T) {
+	long := int64(120)
+	pods := []corev1.Pod{*newPod("pa", "1"), *newPod("pb", "2")}
+	assert.Equal(t, 30*time.Second, maxGracePeriod(pods))
+
+	pods[1].Spec.TerminationGracePeriodSeconds = &long
+	assert.Equal(t, 120*time.Second, maxGracePeriod(pods))
+}
+
+func TestEvictPod(t *testing.T) {
+	defer func(b wait.Backoff) { evictionBackoff = b }(evictionBackoff)
+	evictionBackoff.Duration = time.Millisecond
+	pod := *newPod("pa", "1")
+	gr := schema.GroupResource{Group: "policy", Resource: "pods/eviction"}
+
+	tests := []struct {
+		name      string
+		responses []error
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "should succeed",
+			responses: []error{nil},
+			wantCalls: 1,
+		},
+		{
+			name: "should retry while blocked by PodDisruptionBudget",
+			responses: []error{
+				apierrors.NewTooManyRequests("blocked", 0),
+				apierrors.NewTooManyRequests("blocked", 0),
+				nil,
+			},
+			wantCalls: 3,
+		},
+		{
+			name:      "should treat the deleted pod as succeeded",
+			responses: []error{apierrors.NewNotFound(gr, "pa")},
+			wantCalls: 1,
+		},
+		{
+			name:      "should fail when PodDisruptionBudget is misconfigured",
+			responses: []error{apierrors.NewInternalError(errors.New("multiple PDBs"))},
+			wantErr:   ErrPDBMisconfigured,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cs := fake.NewSimpleClientset()
+			calls := 0
+			cs.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "eviction" {
+					return false, nil, nil
+				}
+				err := tt.responses[calls]
+				calls++
+				return true, nil, err
+			})
+			k8s := K8sClient{clientset: cs}
+
+			err := k8s.evictPod(context.Background(), pod, policyv1beta1.SchemeGroupVersion)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+func TestEvictPodPolicyV1(t *testing.T) {
+	defer func(b wait.Backoff) { evictionBackoff = b }(evictionBackoff)
+	evictionBackoff.Duration = time.Millisecond
+	pod := *newPod("pa", "1")
+	status := func(code int32, reason metav1.StatusReason) *metav1.Status {
+		return &metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Code:     code,
+			Reason:   reason,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		responses []*metav1.Status
+		wantCalls int
+	}{
+		{
+			name:      "should succeed",
+			responses: []*metav1.Status{{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusSuccess, Code: http.StatusCreated}},
+			wantCalls: 1,
+		},
+		{
+			name: "should retry while blocked by PodDisruptionBudget",
+			responses: []*metav1.Status{
+				status(http.StatusTooManyRequests, metav1.StatusReasonTooManyRequests),
+				{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusSuccess, Code: http.StatusCreated},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:      "should treat the deleted pod as succeeded",
+			responses: []*metav1.Status{status(http.StatusNotFound, metav1.StatusReasonNotFound)},
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/api/v1/namespaces/default/pods/pa/eviction", r.URL.Path)
+				var body map[string]interface{}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				assert.Equal(t, "policy/v1", body["apiVersion"])
+				assert.Equal(t, EvictionKind, body["kind"])
+
+				res := tt.responses[atomic.AddInt32(&calls, 1)-1]
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(int(res.Code))
+				json.NewEncoder(w).Encode(res)
+			}))
+			defer srv.Close()
+
+			cs, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+			assert.NoError(t, err)
+			k8s := K8sClient{clientset: cs}
+
+			err = k8s.evictPod(context.Background(), pod, schema.GroupVersion{Group: "policy", Version: "v1"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCalls, int(atomic.LoadInt32(&calls)))
+		})
+	}
+}
+
+func TestEvictPodDeadline(t *testing.T) {
+	defer func(b wait.Backoff) { evictionBackoff = b }(evictionBackoff)
+	evictionBackoff.Duration = time.Millisecond
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewTooManyRequests("blocked", 0)
+	})
+	k8s := K8sClient{clientset: cs}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := k8s.evictPod(ctx, *newPod("pa", "1"), policyv1beta1.SchemeGroupVersion)
+	assert.True(t, errors.Is(err, ErrEvictionBlocked))
+}
+
+func TestEvictionVersion(t *testing.T) {
+	policyGroup := func(version string) *metav1.APIResourceList {
+		return &metav1.APIResourceList{GroupVersion: "policy/" + version}
+	}
+
+	tests := []struct {
+		name      string
+		resources []*metav1.APIResourceList
+		want      schema.GroupVersion
+	}{
+		{
+			name: "should use policy/v1 declared by the subresource",
+			resources: []*metav1.APIResourceList{
+				policyGroup("v1beta1"),
+				{
+					GroupVersion: "v1",
+					APIResources: []metav1.APIResource{
+						{Name: EvictionSubresource, Kind: EvictionKind, Group: "policy", Version: "v1"},
+					},
+				},
+			},
+			want: schema.GroupVersion{Group: "policy", Version: "v1"},
+		},
+		{
+			name: "should fall back to the preferred version of the policy group",
+			resources: []*metav1.APIResourceList{
+				policyGroup("v1beta1"),
+				{
+					GroupVersion: "v1",
+					APIResources: []metav1.APIResource{
+						{Name: EvictionSubresource, Kind: EvictionKind},
+					},
+				},
+			},
+			want: schema.GroupVersion{Group: "policy", Version: "v1beta1"},
+		},
+		{
+			name: "should return empty without the eviction subresource",
+			resources: []*metav1.APIResourceList{
+				policyGroup("v1beta1"),
+				{GroupVersion: "v1"},
+			},
+			want: schema.GroupVersion{},
+		},
+		{
+			name: "should return empty without the policy group",
+			resources: []*metav1.APIResourceList{
+				{GroupVersion: "v1"},
+			},
+			want: schema.GroupVersion{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cs := fake.NewSimpleClientset()
+			cs.Discovery().(*fakediscovery.FakeDiscovery).Resources = tt.resources
+			k8s := K8sClient{clientset: cs}
+
+			got, err := k8s.evictionVersion()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEvictPodWithoutEvictionAPI(t *testing.T) {
+	pod := newPod("pa", "1")
+	cs := fake.NewSimpleClientset(pod)
+	k8s := K8sClient{clientset: cs}
+
+	err := k8s.evictPod(context.Background(), *pod, schema.GroupVersion{})
+	assert.NoError(t, err)
+
+	_, err = cs.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestNewNode(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	node := func(unschedulable bool, conds ...corev1.NodeCondition) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "na",
+				UID:               "ua",
+				Labels:            map[string]string{gkeNodePoolLabel: "pa"},
+				CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+			},
+			Spec:   corev1.NodeSpec{Unschedulable: unschedulable},
+			Status: corev1.NodeStatus{Conditions: conds},
+		}
+	}
+	cond := func(t corev1.NodeConditionType, s corev1.ConditionStatus) corev1.NodeCondition {
+		return corev1.NodeCondition{Type: t, Status: s}
+	}
+
+	tests := []struct {
+		name string
+		node *corev1.Node
+		want *Node
+	}{
+		{
+			name: "ready condition is not the last",
+			node: node(false,
+				cond(corev1.NodeReady, corev1.ConditionTrue),
+				cond(corev1.NodeMemoryPressure, corev1.ConditionFalse),
+			),
+			want: &Node{Name: "na", UID: "ua", NodePool: "pa", Age: time.Hour, Ready: true},
+		},
+		{
+			name: "ready condition is the last but not true",
+			node: node(false,
+				cond(corev1.NodeMemoryPressure, corev1.ConditionFalse),
+				cond(corev1.NodeReady, corev1.ConditionFalse),
+			),
+			want: &Node{Name: "na", UID: "ua", NodePool: "pa", Age: time.Hour},
+		},
+		{
+			name: "cordoned node is not ready",
+			node: node(true, cond(corev1.NodeReady, corev1.ConditionTrue)),
+			want: &Node{Name: "na", UID: "ua", NodePool: "pa", Age: time.Hour},
+		},
+		{
+			name: "pressures are surfaced",
+			node: node(false,
+				cond(corev1.NodeReady, corev1.ConditionTrue),
+				cond(corev1.NodeDiskPressure, corev1.ConditionTrue),
+				cond(corev1.NodePIDPressure, corev1.ConditionTrue),
+				cond(corev1.NodeNetworkUnavailable, corev1.ConditionTrue),
+			),
+			want: &Node{
+				Name:               "na",
+				UID:                "ua",
+				NodePool:           "pa",
+				Age:                time.Hour,
+				Ready:              true,
+				DiskPressure:       true,
+				PIDPressure:        true,
+				NetworkUnavailable: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := newNode(tt.node, now, DefaultNodeLabels())
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	spot := node(false, cond(corev1.NodeReady, corev1.ConditionTrue))
+	spot.Labels[gkeSpotLabel] = "true"
+	got, ok := newNode(spot, now, DefaultNodeLabels())
+	assert.True(t, ok)
+	assert.True(t, got.Spot)
+
+	_, ok = newNode(&corev1.Node{}, now, DefaultNodeLabels())
+	assert.False(t, ok)
+}
+
+func TestNodeLabelsZone(t *testing.T) {
+	custom := NodeLabels{NodePool: "example.com/pool", Zone: "example.com/zone"}
+
+	tests := []struct {
+		name   string
+		keys   NodeLabels
+		labels map[string]string
+		want   string
+	}{
+		{
+			name:   "GA label",
+			keys:   DefaultNodeLabels(),
+			labels: map[string]string{zoneLabel: "asia-northeast1-a", deprecatedZoneLabel: "asia-northeast1-b"},
+			want:   "asia-northeast1-a",
+		},
+		{
+			name:   "fallback to the deprecated label",
+			keys:   DefaultNodeLabels(),
+			labels: map[string]string{deprecatedZoneLabel: "asia-northeast1-b"},
+			want:   "asia-northeast1-b",
+		},
+		{
+			name:   "custom label",
+			keys:   custom,
+			labels: map[string]string{"example.com/zone": "asia-northeast1-c", zoneLabel: "asia-northeast1-a"},
+			want:   "asia-northeast1-c",
+		},
+		{
+			name:   "fallback from the custom label",
+			keys:   custom,
+			labels: map[string]string{zoneLabel: "asia-northeast1-a"},
+			want:   "asia-northeast1-a",
+		},
+		{
+			name:   "no zone label",
+			keys:   DefaultNodeLabels(),
+			labels: map[string]string{},
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.keys.zone(tt.labels))
+		})
+	}
+}
+
+func TestGetNodeListOptOut(t *testing.T) {
+	node := func(name, pool string, annotations map[string]string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      map[string]string{gkeNodePoolLabel: pool},
+				Annotations: annotations,
+			},
+		}
+	}
+	protected := newPod("job", "1")
+	protected.Annotations = map[string]string{doNotDisruptAnnotation: "true"}
+	protected.Spec.NodeName = "nb"
+	completed := newPod("completed", "2")
+	completed.Annotations = map[string]string{doNotDisruptAnnotation: "true"}
+	completed.Status.Phase = corev1.PodSucceeded
+	disabled := newPod("disabled", "4")
+	disabled.Annotations = map[string]string{doNotDisruptAnnotation: "false"}
+	otherPool := newPod("other", "5")
+	otherPool.Annotations = map[string]string{doNotDisruptAnnotation: "true"}
+	otherPool.Spec.NodeName = "nd"
+
+	cs := fake.NewSimpleClientset(
+		node("na", "pa", nil),
+		node("nb", "pa", nil),
+		node("nc", "pa", map[string]string{excludeAnnotation: "true"}),
+		node("nd", "other", nil),
+		protected,
+		completed,
+		disabled,
+		otherPool,
+		newPod("pa", "3"),
+	)
+	podLists := 0
+	cs.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		podLists++
+		return false, nil, nil
+	})
+	k8s := K8sClient{clientset: cs, nodeLabels: DefaultNodeLabels(), pools: []string{"pa"}}
+
+	nodes, err := k8s.GetNodeList(context.Background())
+	assert.NoError(t, err)
+	got := make(map[string]*Node)
+	for _, n := range nodes {
+		got[n.Name] = n
+	}
+	assert.False(t, got["na"].Excluded)
+	assert.Empty(t, got["na"].DoNotDisruptPods)
+	assert.Equal(t, []string{"default/job"}, got["nb"].DoNotDisruptPods)
+	assert.True(t, got["nc"].Excluded)
+	assert.NotContains(t, got, "nd")
+	// the pods are listed once for all nodes
+	assert.Equal(t, 1, podLists)
+}
+
+func TestCloseFlushesEvents(t *testing.T) {
+	defer func(d time.Duration) { eventFlushTimeout = d }(eventFlushTimeout)
+	eventFlushTimeout = 100 * time.Millisecond
+
+	cs := fake.NewSimpleClientset()
+	var (
+		mu     sync.Mutex
+		events []*corev1.Event
+	)
+	cs.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		ev := action.(k8stesting.CreateAction).GetObject().(*corev1.Event)
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+		return true, ev, nil
+	})
+	broadcaster, recorder := newEventRecorder(cs)
+	k8s := K8sClient{clientset: cs, broadcaster: broadcaster, recorder: recorder}
+
+	k8s.Event(&Node{Name: "na"}, corev1.EventTypeNormal, EventReasonInstanceDeleted, "Deleted the instance")
+	assert.NoError(t, k8s.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, EventReasonInstanceDeleted, events[0].Reason)
+		assert.Equal(t, "na", events[0].InvolvedObject.Name)
+	}
+}
+
+func TestPurgeEvents(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "na"}}
+
+	tests := []struct {
+		name    string
+		opts    DrainOptions
+		wantErr bool
+		want    []string
+	}{
+		{
+			name: "purged",
+			opts: DefaultDrainOptions(),
+			want: []string{
+				"Normal Cordoned Cordoned to purge the node",
+				"Normal DrainStarted Draining the node",
+				"Normal PodEvicted Evicted to purge the node na",
+				"Normal NodeDeleted Deleted the node",
+			},
+		},
+		{
+			name:    "rollback on drain failure",
+			opts:    DrainOptions{IgnoreDaemonSets: true},
+			wantErr: true,
+			want: []string{
+				"Normal Cordoned Cordoned to purge the node",
+				"Normal DrainStarted Draining the node",
+				"Warning DrainFailed Failed to drain the node: cannot evict pods not managed by a controller (use force): [default/pa]",
+				"Normal Uncordoned Uncordoned the node failed to purge",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			k8s := K8sClient{
+				clientset:    fake.NewSimpleClientset(node.DeepCopy(), newPod("pa", "1")),
+				drainOptions: tt.opts,
+				recorder:     recorder,
+			}
+
+			err := k8s.Purge(context.Background(), &Node{Name: "na", NodePool: "pa"})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			close(recorder.Events)
+			got := make([]string, 0)
+			for ev := range recorder.Events {
+				got = append(got, ev)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
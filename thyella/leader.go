@@ -0,0 +1,108 @@
+package thyella
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// NewLeaseLock returns the Lease lock for the leader election.
+// The identity is the hostname, which is the pod name in the cluster.
+func NewLeaseLock(kubeconfig, namespace, name string) (resourcelock.Interface, error) {
+	config, err := getRestConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	id, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Client: cs.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
+	}, nil
+}
+
+// RunWithLeaderElection runs the daemon only while holding the lease.
+// On shutdown the lease is kept until the in-flight run finished, so that
+// other replicas never purge concurrently. When the lease is lost, the
+// in-flight run is aborted immediately and the node is uncordoned, then it
+// returns an error.
+func (d *Daemon) RunWithLeaderElection(ctx context.Context, lock resourcelock.Interface, conf LeaderElectionConfig) error {
+	// standby replicas are also ready to take over the lease.
+	atomic.StoreInt32(&d.ready, 1)
+	defer atomic.StoreInt32(&d.ready, 0)
+
+	leCtx, leCancel := context.WithCancel(context.Background())
+	defer leCancel()
+
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	waitFinished := func() {
+		select {
+		case <-started:
+			<-finished
+		default:
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		waitFinished()
+		leCancel()
+	}()
+
+	logger := d.Thyella.logger().With(zap.String("identity", lock.Identity()))
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   conf.LeaseDuration.Duration,
+		RenewDeadline:   conf.RenewDeadline.Duration,
+		RetryPeriod:     conf.RetryPeriod.Duration,
+		ReleaseOnCancel: true,
+		Name:            conf.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				close(started)
+				defer close(finished)
+				logger.Info("started leading")
+				if err := d.run(ctx, leaderCtx); err != nil {
+					logger.Error("failed to run daemon", zap.Error(err))
+				}
+			},
+			OnStoppedLeading: func() {
+				logger.Info("stopped leading")
+			},
+			OnNewLeader: func(identity string) {
+				logger.Info("current leader", zap.String("leader", identity))
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	le.Run(leCtx)
+
+	// wait for the aborted run to uncordon the node.
+	waitFinished()
+	if ctx.Err() == nil {
+		return fmt.Errorf("lost the lease: %s", lock.Describe())
+	}
+	return nil
+}
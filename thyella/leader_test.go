@@ -0,0 +1,51 @@
+package thyella
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestRunWithLeaderElection(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: "thyella", Namespace: "default"},
+		Client:     cs.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: "replica-a"},
+	}
+	conf := DefaultConfig().Daemon.LeaderElection
+	conf.RetryPeriod = metav1.Duration{Duration: 10 * time.Millisecond}
+
+	d := &Daemon{Schedule: cron.Every(time.Hour)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- d.RunWithLeaderElection(ctx, lock, conf)
+	}()
+
+	// wait for acquiring the lease
+	assert.Eventually(t, func() bool {
+		lease, err := cs.CoordinationV1().Leases("default").Get("thyella", metav1.GetOptions{})
+		return err == nil && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == "replica-a"
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("daemon was not stopped")
+	}
+
+	// the lease is released on shutdown
+	lease, err := cs.CoordinationV1().Leases("default").Get("thyella", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.True(t, lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "")
+}
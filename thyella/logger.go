@@ -0,0 +1,103 @@
+package thyella
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// phases of the run, logged as the phase field
+const (
+	phasePlan            = "plan"
+	phaseCordon          = "cordon"
+	phaseDrain           = "drain"
+	phaseDeleteNode      = "delete_node"
+	phaseDeleteInstance  = "delete_instance"
+	phaseWaitReplacement = "wait_replacement"
+)
+
+// NewLogger returns the JSON logger compatible with the structured logging
+// of Cloud Logging, writing to stderr.
+func NewLogger(level string) (*zap.Logger, error) {
+	return newLogger(level, zapcore.Lock(os.Stderr))
+}
+
+func newLogger(level string, w zapcore.WriteSyncer) (*zap.Logger, error) {
+	var lv zapcore.Level
+	if err := lv.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	encoderConfig := zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "severity",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		MessageKey:     "message",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    encodeSeverity,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), w, lv)
+	return zap.New(core, zap.AddCaller(), zap.ErrorOutput(w)), nil
+}
+
+// encodeSeverity encodes the level to the severity of Cloud Logging.
+func encodeSeverity(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	switch l {
+	case zapcore.DebugLevel:
+		enc.AppendString("DEBUG")
+	case zapcore.InfoLevel:
+		enc.AppendString("INFO")
+	case zapcore.WarnLevel:
+		enc.AppendString("WARNING")
+	case zapcore.ErrorLevel:
+		enc.AppendString("ERROR")
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		enc.AppendString("CRITICAL")
+	case zapcore.FatalLevel:
+		enc.AppendString("EMERGENCY")
+	default:
+		enc.AppendString("DEFAULT")
+	}
+}
+
+// nodeFields returns the fields identifying the node.
+func nodeFields(n *Node) []zap.Field {
+	return []zap.Field{
+		zap.String("node", n.Name),
+		zap.String("pool", n.NodePool),
+		zap.String("zone", n.Zone),
+	}
+}
+
+func newRunID() string {
+	return string(uuid.NewUUID())
+}
+
+type loggerKey struct{}
+
+// withLogger returns ctx carrying the logger, so that the clients log with
+// the fields of the run.
+func withLogger(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger in ctx, or the fallback. It returns the no-op
+// logger when both are nil.
+func loggerFrom(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok && l != nil {
+		return l
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return zap.NewNop()
+}
@@ -0,0 +1,41 @@
+package thyella
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger("info", zapcore.AddSync(&buf))
+	assert.NoError(t, err)
+
+	logger.Debug("dropped")
+	logger.Warn("blocked", nodeFields(&Node{Name: "na", NodePool: "pa", Zone: "za"})...)
+
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "WARNING", got["severity"])
+	assert.Equal(t, "blocked", got["message"])
+	assert.Equal(t, "na", got["node"])
+	assert.Equal(t, "pa", got["pool"])
+	assert.Equal(t, "za", got["zone"])
+
+	_, err = NewLogger("verbose")
+	assert.Error(t, err)
+}
+
+func TestLoggerFrom(t *testing.T) {
+	fallback := zap.NewExample()
+	assert.Equal(t, fallback, loggerFrom(context.Background(), fallback))
+	assert.NotNil(t, loggerFrom(context.Background(), nil))
+
+	l := zap.NewExample().With(zap.String("run_id", "1"))
+	assert.Equal(t, l, loggerFrom(withLogger(context.Background(), l), fallback))
+}
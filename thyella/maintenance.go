@@ -0,0 +1,171 @@
+package thyella
+
+import (
+	"fmt"
+	"time"
+)
+
+// layouts of maintenance settings
+const (
+	clockLayout = "15:04"
+	dateLayout  = "2006-01-02"
+)
+
+// MaintenanceConfig represents when nodes are allowed to be purged
+type MaintenanceConfig struct {
+	// TimeZone represents the IANA time zone of windows and blackouts,
+	// e.g. Asia/Tokyo. Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// Windows represents the time ranges allowed to purge. Always allowed
+	// when empty.
+	Windows []MaintenanceWindow `json:"windows,omitempty"`
+	// Blackouts represents the dates never allowed to purge, e.g. release
+	// freezes. It takes priority over windows.
+	Blackouts []Blackout `json:"blackouts,omitempty"`
+}
+
+// MaintenanceWindow represents a time range of the weekdays
+type MaintenanceWindow struct {
+	// Days represents the weekdays the window starts, e.g. [Mon, Tue].
+	// Every day when empty.
+	Days []string `json:"days,omitempty"`
+	// Start and End represent the time of day, e.g. 22:00. The window ends
+	// on the next day when End is not after Start.
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Blackout represents the dates, both inclusive
+type Blackout struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// Validate returns an error when the maintenance settings are invalid.
+func (m MaintenanceConfig) Validate() error {
+	if _, err := time.LoadLocation(m.TimeZone); err != nil {
+		return fmt.Errorf("invalid timeZone: %w", err)
+	}
+	for i, w := range m.Windows {
+		if _, err := w.parse(); err != nil {
+			return fmt.Errorf("invalid windows[%d]: %w", i, err)
+		}
+	}
+	for i, b := range m.Blackouts {
+		start, end, err := b.parse(time.UTC)
+		if err != nil {
+			return fmt.Errorf("invalid blackouts[%d]: %w", i, err)
+		}
+		if end.Before(start) {
+			return fmt.Errorf("invalid blackouts[%d]: end is before start", i)
+		}
+	}
+	return nil
+}
+
+// check returns the reason when nodes are not allowed to be purged at now.
+func (m MaintenanceConfig) check(now time.Time) (Reason, bool, error) {
+	loc, err := time.LoadLocation(m.TimeZone)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to load timeZone: %w", err)
+	}
+	now = now.In(loc)
+
+	for _, b := range m.Blackouts {
+		start, end, err := b.parse(loc)
+		if err != nil {
+			return "", false, err
+		}
+		if !now.Before(start) && now.Before(end.AddDate(0, 0, 1)) {
+			return ReasonBlackout, false, nil
+		}
+	}
+
+	if len(m.Windows) == 0 {
+		return "", true, nil
+	}
+	for _, w := range m.Windows {
+		ok, err := w.contains(now)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return "", true, nil
+		}
+	}
+	return ReasonOutsideMaintenanceWindow, false, nil
+}
+
+// window represents the parsed MaintenanceWindow in minutes of the day
+type window struct {
+	days       map[time.Weekday]bool
+	start, end int
+}
+
+func (w MaintenanceWindow) parse() (*window, error) {
+	ret := &window{days: make(map[time.Weekday]bool)}
+	for _, d := range w.Days {
+		wd, ok := weekdays[d]
+		if !ok {
+			return nil, fmt.Errorf("unknown day: %s", d)
+		}
+		ret.days[wd] = true
+	}
+	start, err := time.Parse(clockLayout, w.Start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse start: %w", err)
+	}
+	end, err := time.Parse(clockLayout, w.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse end: %w", err)
+	}
+	ret.start = start.Hour()*60 + start.Minute()
+	ret.end = end.Hour()*60 + end.Minute()
+	return ret, nil
+}
+
+// contains returns whether the time is in the window.
+func (w MaintenanceWindow) contains(t time.Time) (bool, error) {
+	win, err := w.parse()
+	if err != nil {
+		return false, err
+	}
+	startsOn := func(d time.Weekday) bool {
+		return len(win.days) == 0 || win.days[d]
+	}
+
+	m := t.Hour()*60 + t.Minute()
+	if win.start < win.end {
+		return startsOn(t.Weekday()) && win.start <= m && m < win.end, nil
+	}
+	// the window over midnight
+	if m >= win.start {
+		return startsOn(t.Weekday()), nil
+	}
+	if m < win.end {
+		return startsOn((t.Weekday() + 6) % 7), nil
+	}
+	return false, nil
+}
+
+func (b Blackout) parse(loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(dateLayout, b.Start, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to parse start: %w", err)
+	}
+	end, err := time.ParseInLocation(dateLayout, b.End, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to parse end: %w", err)
+	}
+	return start, end, nil
+}
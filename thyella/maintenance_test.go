@@ -0,0 +1,132 @@
+package thyella
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceCheck(t *testing.T) {
+	tokyo := func(s string) time.Time {
+		loc, err := time.LoadLocation("Asia/Tokyo")
+		assert.NoError(t, err)
+		ts, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		assert.NoError(t, err)
+		return ts
+	}
+	config := MaintenanceConfig{
+		TimeZone: "Asia/Tokyo",
+		Windows: []MaintenanceWindow{
+			// weekday nights
+			{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Start: "22:00", End: "06:00"},
+			// weekends
+			{Days: []string{"Sat", "Sun"}, Start: "00:00", End: "23:59"},
+		},
+		Blackouts: []Blackout{{Start: "2020-12-28", End: "2021-01-03"}},
+	}
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		wantOK     bool
+		wantReason Reason
+	}{
+		{
+			name:   "Monday night",
+			now:    tokyo("2020-01-06 23:00"),
+			wantOK: true,
+		},
+		{
+			name:   "Tuesday early morning in the window started on Monday",
+			now:    tokyo("2020-01-07 05:59"),
+			wantOK: true,
+		},
+		{
+			name:       "Tuesday daytime",
+			now:        tokyo("2020-01-07 12:00"),
+			wantReason: ReasonOutsideMaintenanceWindow,
+		},
+		{
+			name:       "Monday early morning, the window on Sunday is not over midnight",
+			now:        tokyo("2020-01-06 03:00"),
+			wantReason: ReasonOutsideMaintenanceWindow,
+		},
+		{
+			name:   "Saturday in UTC is converted to the time zone",
+			now:    time.Date(2020, 1, 10, 16, 0, 0, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:       "last day of the blackout",
+			now:        tokyo("2021-01-03 23:00"),
+			wantReason: ReasonBlackout,
+		},
+		{
+			name:   "after the blackout",
+			now:    tokyo("2021-01-04 23:00"),
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok, err := config.check(tt.now)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+
+	_, ok, err := MaintenanceConfig{}.check(time.Now())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestMaintenanceValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  MaintenanceConfig
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			config: MaintenanceConfig{
+				TimeZone:  "America/New_York",
+				Windows:   []MaintenanceWindow{{Days: []string{"Sat"}, Start: "01:00", End: "05:00"}},
+				Blackouts: []Blackout{{Start: "2020-11-26", End: "2020-11-27"}},
+			},
+		},
+		{
+			name:    "unknown time zone",
+			config:  MaintenanceConfig{TimeZone: "Mars/Olympus"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown day",
+			config:  MaintenanceConfig{Windows: []MaintenanceWindow{{Days: []string{"Monday"}, Start: "01:00", End: "05:00"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid time",
+			config:  MaintenanceConfig{Windows: []MaintenanceWindow{{Start: "25:00", End: "05:00"}}},
+			wantErr: true,
+		},
+		{
+			name:    "blackout ends before start",
+			config:  MaintenanceConfig{Blackouts: []Blackout{{Start: "2020-11-27", End: "2020-11-26"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
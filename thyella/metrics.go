@@ -0,0 +1,102 @@
+package thyella
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const metricsNamespace = "thyella"
+
+// labels of api errors
+const (
+	apiGKE = "gke"
+	apiK8s = "k8s"
+)
+
+var (
+	purgeAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "purge_attempts_total",
+		Help:      "Number of attempts to purge a node.",
+	}, []string{"node_pool"})
+
+	purges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "purges_total",
+		Help:      "Number of purged nodes by result, succeeded or failed.",
+	}, []string{"node_pool", "result"})
+
+	skips = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "skips_total",
+		Help:      "Number of node-pools skipped to purge by reason.",
+	}, []string{"node_pool", "reason"})
+
+	drainDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "drain_duration_seconds",
+		Help:      "Time to drain a node.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"node_pool"})
+
+	podsEvicted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pods_evicted_total",
+		Help:      "Number of evicted pods.",
+	}, []string{"node_pool"})
+
+	evictionRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "eviction_retries_total",
+		Help:      "Number of eviction retries blocked by PodDisruptionBudget.",
+	})
+
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_errors_total",
+		Help:      "Number of errors returned by GKE and Kubernetes APIs.",
+	}, []string{"api", "operation"})
+
+	purgedNodeAge = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "purged_node_age_seconds",
+		Help:      "Age of the purged node.",
+		Buckets:   prometheus.ExponentialBuckets(3600, 2, 8),
+	}, []string{"node_pool"})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		purgeAttempts,
+		purges,
+		skips,
+		drainDuration,
+		podsEvicted,
+		evictionRetries,
+		apiErrors,
+		purgedNodeAge,
+	)
+}
+
+// MetricsHandler returns the handler serving metrics for Prometheus
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// PushMetrics pushes metrics to the Pushgateway compatible endpoint
+func PushMetrics(url, job string) error {
+	return push.New(url, job).Gatherer(registry).Push()
+}
+
+// observeAPIError counts the error of the API, and returns the err as it is.
+func observeAPIError(api, operation string, err error) error {
+	if err != nil {
+		apiErrors.WithLabelValues(api, operation).Inc()
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package thyella
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/api/compute/v1"
+)
+
+// DeleteStrategy represents how to delete the instance of the node
+type DeleteStrategy string
+
+// delete strategies
+const (
+	// DeleteStrategyInstance deletes the instance directly, and the managed
+	// instance group recreates it.
+	DeleteStrategyInstance DeleteStrategy = "instance"
+	// DeleteStrategyRecreate recreates the instance via the managed instance
+	// group, keeping the target size.
+	DeleteStrategyRecreate DeleteStrategy = "recreate"
+	// DeleteStrategyDelete deletes the instance via the managed instance
+	// group, decreasing the target size.
+	DeleteStrategyDelete DeleteStrategy = "delete"
+)
+
+// MIGClient is KaasProvider deleting the instance via the managed instance
+// group of the node-pool
+type MIGClient struct {
+	*GKEClient
+	strategy DeleteStrategy
+}
+
+// NewMIGClient returns initialized MIGClient
+func NewMIGClient(gke *GKEClient, strategy DeleteStrategy) (*MIGClient, error) {
+	if strategy != DeleteStrategyRecreate && strategy != DeleteStrategyDelete {
+		return nil, fmt.Errorf("unsupported delete strategy: %s", strategy)
+	}
+	return &MIGClient{
+		GKEClient: gke,
+		strategy:  strategy,
+	}, nil
+}
+
+// DeleteInstance recreates or deletes the instance via the managed instance
+// group in the zone of the node.
+func (mig MIGClient) DeleteInstance(ctx context.Context, clusterName string, node *Node) (*InstanceState, error) {
+	if node.Zone == "" {
+		return nil, fmt.Errorf("unknown zone of the node: %s", node.Name)
+	}
+
+	np, err := mig.GetNodePool(ctx, clusterName, node.NodePool, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mig.deleteInstance(ctx, mig.compute, node, np.ZoneURLs)
+}
+
+func (mig MIGClient) deleteInstance(ctx context.Context, c *compute.Service, node *Node, groupURLs []string) (*InstanceState, error) {
+	igm, err := instanceGroupManager(groupURLs, node.Zone)
+	if err != nil {
+		return nil, err
+	}
+	logger := loggerFrom(ctx, mig.logger).With(
+		zap.String("phase", phaseDeleteInstance),
+		zap.String("instance_group_manager", igm),
+		zap.String("strategy", string(mig.strategy)),
+	)
+
+	instances := []string{fmt.Sprintf("zones/%s/instances/%s", node.Zone, node.Name)}
+	var op *compute.Operation
+	switch mig.strategy {
+	case DeleteStrategyRecreate:
+		op, err = c.InstanceGroupManagers.RecreateInstances(mig.project, node.Zone, igm,
+			&compute.InstanceGroupManagersRecreateInstancesRequest{Instances: instances}).Context(ctx).Do()
+		err = observeAPIError(apiGKE, "recreate_instances", err)
+	default:
+		op, err = c.InstanceGroupManagers.DeleteInstances(mig.project, node.Zone, igm,
+			&compute.InstanceGroupManagersDeleteInstancesRequest{Instances: instances}).Context(ctx).Do()
+		err = observeAPIError(apiGKE, "delete_instances", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s instance via %s: %w", mig.strategy, igm, err)
+	}
+	logger.Info("requested to delete instance", zap.String("operation", op.Name))
+
+	op, err = mig.waitForOperation(ctx, c, node.Zone, op)
+	if err != nil {
+		return nil, err
+	}
+	state := mig.instanceState(ctx, c, node, op)
+	logger.Info("deleted instance", zap.Reflect("instance", state))
+	return state, nil
+}
+
+// instanceGroupManager returns the name of the instance group manager in the
+// zone from the instance group URLs of the node-pool.
+// e.g. https://www.googleapis.com/compute/v1/projects/p/zones/z/instanceGroupManagers/gke-c-pool-grp
+func instanceGroupManager(urls []string, zone string) (string, error) {
+	for _, u := range urls {
+		z, name := parseInstanceGroupURL(u)
+		if z == zone && name != "" {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("not found the instance group in the zone: %s", zone)
+}
+
+// parseInstanceGroupURL returns the zone and the name of the instance group.
+// They are empty when the URL is unknown format.
+func parseInstanceGroupURL(u string) (zone, name string) {
+	parts := strings.Split(u, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "zones":
+			zone = parts[i+1]
+		case "instanceGroupManagers", "instanceGroups":
+			name = parts[i+1]
+		}
+	}
+	return zone, name
+}
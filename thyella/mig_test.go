@@ -0,0 +1,109 @@
+package thyella
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestInstanceGroupManager(t *testing.T) {
+	urls := []string{
+		"https://www.googleapis.com/compute/v1/projects/p/zones/za/instanceGroupManagers/gke-c-pa-1-grp",
+		"https://www.googleapis.com/compute/v1/projects/p/zones/zb/instanceGroupManagers/gke-c-pa-2-grp",
+	}
+
+	tests := []struct {
+		name    string
+		zone    string
+		want    string
+		wantErr bool
+	}{
+		{name: "first zone", zone: "za", want: "gke-c-pa-1-grp"},
+		{name: "second zone", zone: "zb", want: "gke-c-pa-2-grp"},
+		{name: "unknown zone", zone: "zc", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := instanceGroupManager(urls, tt.zone)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMIGDeleteInstance(t *testing.T) {
+	defer func(d time.Duration) { operationPollInterval = d }(operationPollInterval)
+	operationPollInterval = time.Millisecond
+
+	node := &Node{Name: "na", NodePool: "pa", Zone: "za"}
+	urls := []string{"https://www.googleapis.com/compute/v1/projects/project/zones/za/instanceGroupManagers/grp"}
+
+	tests := []struct {
+		name       string
+		strategy   DeleteStrategy
+		wantPath   string
+		instance   *compute.Instance
+		wantStatus string
+	}{
+		{
+			name:       "recreate",
+			strategy:   DeleteStrategyRecreate,
+			wantPath:   "/projects/project/zones/za/instanceGroupManagers/grp/recreateInstances",
+			instance:   &compute.Instance{Name: "na", Status: "PROVISIONING"},
+			wantStatus: "PROVISIONING",
+		},
+		{
+			name:       "delete",
+			strategy:   DeleteStrategyDelete,
+			wantPath:   "/projects/project/zones/za/instanceGroupManagers/grp/deleteInstances",
+			wantStatus: InstanceStatusDeleted,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			mux := http.NewServeMux()
+			mux.HandleFunc(tt.wantPath, func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				assert.Equal(t, http.MethodPost, r.Method)
+				var req struct {
+					Instances []string `json:"instances"`
+				}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, []string{"zones/za/instances/na"}, req.Instances)
+				json.NewEncoder(w).Encode(&compute.Operation{Name: "op", Status: "RUNNING"})
+			})
+			mux.HandleFunc("/projects/project/zones/za/instances/na", func(w http.ResponseWriter, r *http.Request) {
+				if tt.instance == nil {
+					http.Error(w, "not found", http.StatusNotFound)
+					return
+				}
+				json.NewEncoder(w).Encode(tt.instance)
+			})
+			mux.HandleFunc("/projects/project/zones/za/operations/op", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(&compute.Operation{Name: "op", Status: "DONE"})
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			c, err := compute.New(srv.Client())
+			assert.NoError(t, err)
+			c.BasePath = srv.URL + "/"
+
+			mig, err := NewMIGClient(&GKEClient{project: "project"}, tt.strategy)
+			assert.NoError(t, err)
+			state, err := mig.deleteInstance(context.Background(), c, node, urls)
+			assert.NoError(t, err)
+			assert.True(t, called)
+			assert.Equal(t, &InstanceState{Node: "na", Operation: "op", OperationStatus: "DONE", Status: tt.wantStatus}, state)
+		})
+	}
+}
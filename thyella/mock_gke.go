@@ -49,11 +49,12 @@ func (mr *MockKaasProviderMockRecorder) GetNodePool(ctx, clusterName, poolName,
 }
 
 // DeleteInstance mocks base method
-func (m *MockKaasProvider) DeleteInstance(ctx context.Context, clusterName string, node *Node) error {
+func (m *MockKaasProvider) DeleteInstance(ctx context.Context, clusterName string, node *Node) (*InstanceState, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "DeleteInstance", ctx, clusterName, node)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*InstanceState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // DeleteInstance indicates an expected call of DeleteInstance
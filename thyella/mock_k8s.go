@@ -61,3 +61,29 @@ func (mr *MockK8sAccessorMockRecorder) Purge(ctx, node interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockK8sAccessor)(nil).Purge), ctx, node)
 }
+
+// Event mocks base method
+func (m *MockK8sAccessor) Event(node *Node, eventType, reason, message string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Event", node, eventType, reason, message)
+}
+
+// Event indicates an expected call of Event
+func (mr *MockK8sAccessorMockRecorder) Event(node, eventType, reason, message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Event", reflect.TypeOf((*MockK8sAccessor)(nil).Event), node, eventType, reason, message)
+}
+
+// Close mocks base method
+func (m *MockK8sAccessor) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close
+func (mr *MockK8sAccessorMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockK8sAccessor)(nil).Close))
+}
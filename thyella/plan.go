@@ -0,0 +1,70 @@
+package thyella
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reason represents why a node was chosen or a node-pool was skipped
+type Reason string
+
+// list of reasons
+const (
+	ReasonOldestNode               Reason = "oldest node in the node-pool"
+	ReasonOldestNodeWithBalance    Reason = "oldest node in the most crowded zone"
+	ReasonNoNodePools              Reason = "no node-pools specified"
+	ReasonNoNodes                  Reason = "no nodes in the cluster"
+	ReasonUnhealthy                Reason = "node-pool is unhealthy"
+	ReasonMinimumNodes             Reason = "node-pool is running the minimum nodes"
+	ReasonNoCandidate              Reason = "no purgeable node"
+	ReasonExcludedByConfig         Reason = "node is excluded by the config"
+	ReasonYoungerThanMinAge        Reason = "node is younger than the minimum age"
+	ReasonExcludedByAnnotation     Reason = "node is annotated with thyella.io/exclude"
+	ReasonOutsideMaintenanceWindow Reason = "outside maintenance window"
+	ReasonBlackout                 Reason = "in blackout period"
+	ReasonBudgetExhausted          Reason = "disruption budget is exhausted"
+	ReasonNoSelectionRule          Reason = "no selection rule for the capacity type"
+	ReasonDoNotDisruptPods         Reason = "node is running pods annotated with thyella.io/do-not-disrupt"
+)
+
+// Plan represents the purge decision for a node-pool group
+type Plan struct {
+	Group    []string       `json:"group"`
+	Target   *Node          `json:"target,omitempty"`
+	NodePool string         `json:"nodePool,omitempty"`
+	Reason   Reason         `json:"reason"`
+	Skipped  []*SkippedPool `json:"skipped,omitempty"`
+	Excluded []*Exclusion   `json:"excluded,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// SkippedPool represents the node-pool which was not chosen
+type SkippedPool struct {
+	NodePool string `json:"nodePool"`
+	Reason   Reason `json:"reason"`
+}
+
+func (p *Plan) choose(np *NodePool, target *Node, reason Reason) {
+	p.Target = target
+	p.NodePool = np.Name
+	p.Reason = reason
+}
+
+func (p *Plan) skip(pool string, reason Reason) {
+	p.Skipped = append(p.Skipped, &SkippedPool{NodePool: pool, Reason: reason})
+}
+
+func (p Plan) String() string {
+	skipped := make([]string, 0)
+	for _, s := range p.Skipped {
+		skipped = append(skipped, fmt.Sprintf("%s(%s)", s.NodePool, s.Reason))
+	}
+	if p.Error != "" {
+		return fmt.Sprintf("error: %s", p.Error)
+	}
+	if p.Target == nil {
+		return fmt.Sprintf("no target: %s, skipped: [%s]", p.Reason, strings.Join(skipped, ","))
+	}
+	return fmt.Sprintf("target: %s/%s: %s, skipped: [%s]",
+		p.NodePool, p.Target.Name, p.Reason, strings.Join(skipped, ","))
+}
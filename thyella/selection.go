@@ -0,0 +1,79 @@
+package thyella
+
+import (
+	"fmt"
+)
+
+// CapacityType represents the capacity type of nodes in the node-pool
+type CapacityType string
+
+// capacity types
+const (
+	CapacityTypeOnDemand    CapacityType = "on-demand"
+	CapacityTypePreemptible CapacityType = "preemptible"
+	CapacityTypeSpot        CapacityType = "spot"
+)
+
+// SelectionStrategy represents how to choose the node to purge in the
+// node-pool
+type SelectionStrategy string
+
+// selection strategies
+const (
+	// SelectionOldest chooses the oldest node in the node-pool.
+	SelectionOldest SelectionStrategy = "oldest"
+	// SelectionOldestWithBalance chooses the oldest node in the most crowded
+	// zone, to keep zones balanced.
+	SelectionOldestWithBalance SelectionStrategy = "oldestWithBalance"
+)
+
+// SelectionRule represents how to purge the node-pools of the capacity type.
+// Rules are evaluated in order, and the first node chosen is purged.
+type SelectionRule struct {
+	CapacityType CapacityType      `json:"capacityType"`
+	Strategy     SelectionStrategy `json:"strategy"`
+	// RespectMinimumNodes skips the node-pool running the minimum nodes.
+	RespectMinimumNodes bool `json:"respectMinimumNodes,omitempty"`
+}
+
+// DefaultSelectionRules returns the rules purging on-demand nodes first with
+// zone balancing, then preemptible and Spot nodes.
+func DefaultSelectionRules() []SelectionRule {
+	return []SelectionRule{
+		{CapacityType: CapacityTypeOnDemand, Strategy: SelectionOldestWithBalance, RespectMinimumNodes: true},
+		{CapacityType: CapacityTypePreemptible, Strategy: SelectionOldest},
+		{CapacityType: CapacityTypeSpot, Strategy: SelectionOldest},
+	}
+}
+
+func validateSelectionRules(rules []SelectionRule) error {
+	seen := make(map[CapacityType]bool)
+	for i, r := range rules {
+		switch r.CapacityType {
+		case CapacityTypeOnDemand, CapacityTypePreemptible, CapacityTypeSpot:
+		default:
+			return fmt.Errorf("unknown capacityType of selection[%d]: %s", i, r.CapacityType)
+		}
+		if seen[r.CapacityType] {
+			return fmt.Errorf("capacityType(%s) is configured multiple times", r.CapacityType)
+		}
+		seen[r.CapacityType] = true
+
+		switch r.Strategy {
+		case SelectionOldest, SelectionOldestWithBalance:
+		default:
+			return fmt.Errorf("unknown strategy of selection[%d]: %s", i, r.Strategy)
+		}
+	}
+	return nil
+}
+
+// choose returns the node to purge in the node-pool by the strategy.
+func (r SelectionRule) choose(np *NodePool) (*Node, Reason, bool) {
+	if r.Strategy == SelectionOldestWithBalance {
+		target, ok := np.GetMaxAgeNodeWithBalance()
+		return target, ReasonOldestNodeWithBalance, ok
+	}
+	target, ok := np.GetMaxAgeNode()
+	return target, ReasonOldestNode, ok
+}
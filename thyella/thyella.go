@@ -3,34 +3,174 @@ package thyella
 import (
 	"context"
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
-	"github.com/K0kubun/pp"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+// replacementPollInterval is the interval to check the node-pool waiting for
+// the replacement node.
+var replacementPollInterval = 30 * time.Second
+
 // Thyella provide purge
 type Thyella struct {
 	KaasClient KaasProvider
 	K8sClient  K8sAccessor
+
+	// Config represents settings for each node-pool, optional.
+	Config *Config
+	// Logger is optional, nothing is logged when nil.
+	Logger *zap.Logger
 }
 
-// Purge purge nodes.
-func (p Thyella) Purge(cluster string, nps []string) error {
-	ctx := context.Background()
+func (p Thyella) logger() *zap.Logger {
+	if p.Logger == nil {
+		return zap.NewNop()
+	}
+	return p.Logger
+}
 
-	if len(nps) == 0 {
-		return nil
+// withRun returns ctx carrying the logger with the fields of a new run.
+func (p Thyella) withRun(ctx context.Context, cluster string) context.Context {
+	l := p.logger().With(
+		zap.String("cluster", cluster),
+		zap.String("run_id", newRunID()),
+	)
+	return withLogger(ctx, l)
+}
+
+// Result represents the purge result for a node-pool group
+type Result struct {
+	Group []string
+	Nodes []*Node
+	// Instances represents the final states of the deleted instances of
+	// Nodes.
+	Instances []*InstanceState
+	Err       error
+}
+
+// Purge purge nodes for each node-pool group.
+// It purges a node in a group by default. When maxUnavailable of a node-pool
+// in the group is configured, it purges nodes one by one, re-evaluating the
+// node-pools, while the node-pool has the disruption budget.
+// It continues to purge other groups even if a group failed, and returns
+// the results of all groups.
+func (p Thyella) Purge(ctx context.Context, cluster string, groups [][]string) ([]*Result, error) {
+	if len(groups) == 0 {
+		return nil, nil
 	}
+	ctx = p.withRun(ctx, cluster)
+	logger := loggerFrom(ctx, p.Logger)
 
-	nodes, err := p.K8sClient.GetNodeList(ctx)
+	nodes, nodeEachPools, err := p.fetchNodes(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(nodes) == 0 {
+		return nil, nil
+	}
+	budget, err := newDisruptionBudget(p.Config, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0, len(groups))
+	errs := make([]string, 0)
+	for _, group := range groups {
+		res := &Result{Group: group}
+		for {
+			if err := ctx.Err(); err != nil {
+				errs = append(errs, fmt.Sprintf("%v: aborted: %v", group, err))
+				res.Err = err
+				break
+			}
+
+			n, state, ok, err := p.purgeInGroup(ctx, cluster, group, nodes, nodeEachPools, budget)
+			if ok {
+				logger.Info("purged node", append(nodeFields(n), zap.Reflect("instance", state))...)
+				res.Nodes = append(res.Nodes, n)
+				res.Instances = append(res.Instances, state)
+				budget.consume(n)
+			}
+			if err != nil {
+				logger.Error("failed to purge in group", zap.Strings("group", group), zap.Error(err))
+				errs = append(errs, fmt.Sprintf("%v: %v", group, err))
+				res.Err = err
+				break
+			}
+			// node-pools without the budget are skipped in the next plan
+			if !ok || budget.exhausted(group) {
+				break
+			}
+
+			// re-evaluate the node-pools with the latest nodes, other groups
+			// keep the previous nodes when failed
+			latest, _, err := p.fetchNodes(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%v: %v", group, err))
+				res.Err = err
+				break
+			}
+			nodes = budget.remaining(latest)
+			nodeEachPools = firstNodeEachPools(nodes)
+		}
+		results = append(results, res)
+	}
+	return results, groupError(errs)
+}
+
+// Plan returns the purge decision for each node-pool group without purging
+// any node.
+func (p Thyella) Plan(ctx context.Context, cluster string, groups [][]string) ([]*Plan, error) {
+	if len(groups) == 0 {
+		return []*Plan{{Reason: ReasonNoNodePools}}, nil
+	}
+	ctx = p.withRun(ctx, cluster)
+
+	nodes, nodeEachPools, err := p.fetchNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]*Plan, 0, len(groups))
+	errs := make([]string, 0)
+	for _, group := range groups {
+		if len(nodes) == 0 {
+			plans = append(plans, &Plan{Group: group, Reason: ReasonNoNodes})
+			continue
+		}
+
+		plan, err := p.planInGroup(ctx, cluster, group, nodes, nodeEachPools, nil)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", group, err))
+			plan = &Plan{Group: group, Error: err.Error()}
+		}
+		plans = append(plans, plan)
+	}
+	return plans, groupError(errs)
+}
+
+func groupError(errs []string) error {
+	if len(errs) == 0 {
 		return nil
 	}
+	return fmt.Errorf("failed in %d node-pool group(s): %s", len(errs), strings.Join(errs, "; "))
+}
 
-	// find a node from all nodes.
+// fetchNodes returns all nodes and a node for each node-pool.
+func (p Thyella) fetchNodes(ctx context.Context) ([]*Node, map[string]*Node, error) {
+	nodes, err := p.K8sClient.GetNodeList(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodes, firstNodeEachPools(nodes), nil
+}
+
+// firstNodeEachPools finds a node for each node-pool from all nodes.
+func firstNodeEachPools(nodes []*Node) map[string]*Node {
 	nodeEachPools := make(map[string]*Node)
 	for _, n := range nodes {
 		if _, ok := nodeEachPools[n.NodePool]; ok {
@@ -38,73 +178,206 @@ func (p Thyella) Purge(cluster string, nps []string) error {
 		}
 		nodeEachPools[n.NodePool] = n
 	}
+	return nodeEachPools
+}
 
-	n, ok, err := p.purgeInGroup(ctx, cluster, nps, nodes, nodeEachPools)
+// purgeInGroup purges the node planned in the node-pool group, and returns
+// the node and the final state of its instance.
+func (p Thyella) purgeInGroup(ctx context.Context, cluster string, group []string, nodes []*Node, nodeEachPools map[string]*Node, budget *disruptionBudget) (*Node, *InstanceState, bool, error) {
+	plan, err := p.planInGroup(ctx, cluster, group, nodes, nodeEachPools, budget)
 	if err != nil {
-		return err
+		return nil, nil, false, err
 	}
-	if ok {
-		log.Printf("purge node: %s\n", n.Name)
+	for _, s := range plan.Skipped {
+		skips.WithLabelValues(s.NodePool, string(s.Reason)).Inc()
+	}
+	if plan.Target == nil {
+		// not found a purgeable node
+		return nil, nil, false, nil
+	}
+
+	target := plan.Target
+	ctx = withLogger(ctx, loggerFrom(ctx, p.Logger).With(nodeFields(target)...))
+	loggerFrom(ctx, p.Logger).Info("purging node", zap.String("reason", string(plan.Reason)))
+	purgeAttempts.WithLabelValues(target.NodePool).Inc()
+	if err := p.purgeNode(ctx, target); err != nil {
+		purges.WithLabelValues(target.NodePool, "failed").Inc()
+		return nil, nil, false, fmt.Errorf("failed to purge node: %s %w", target.Name, err)
+	}
+	state, err := p.KaasClient.DeleteInstance(ctx, cluster, target)
+	if err != nil {
+		purges.WithLabelValues(target.NodePool, "failed").Inc()
+		p.K8sClient.Event(target, corev1.EventTypeWarning, EventReasonInstanceDeleteFailed, fmt.Sprintf("Failed to delete the instance: %v", err))
+		return nil, nil, false, fmt.Errorf("failed to delete instance: %s %w", target.Name, err)
+	}
+	p.K8sClient.Event(target, corev1.EventTypeNormal, EventReasonInstanceDeleted, fmt.Sprintf("Deleted the instance: %s", state.Status))
+	purges.WithLabelValues(target.NodePool, "succeeded").Inc()
+	purgedNodeAge.WithLabelValues(target.NodePool).Observe(target.Age.Seconds())
+
+	if err := p.waitForReplacement(ctx, cluster, target, readyNodes(nodes, target.NodePool)); err != nil {
+		return target, state, true, err
+	}
+	return target, state, true, nil
+}
+
+// waitForReplacement waits until the node-pool gets back the ready nodes
+// before the purge and RUNNING status, within the replacement timeout.
+func (p Thyella) waitForReplacement(ctx context.Context, cluster string, purged *Node, want int) error {
+	pc := p.Config.PoolConfig(purged.NodePool)
+	if pc.ReplacementTimeout.Duration <= 0 {
+		return nil
+	}
+
+	logger := loggerFrom(ctx, p.Logger).With(zap.String("phase", phaseWaitReplacement))
+	logger.Info("waiting for the replacement node", zap.Int("want_ready_nodes", want))
+	ctx, cancel := context.WithTimeout(ctx, pc.ReplacementTimeout.Duration)
+	defer cancel()
+
+	var ready int
+	var status string
+	err := wait.PollImmediateUntil(replacementPollInterval, func() (bool, error) {
+		nodes, err := p.K8sClient.GetNodeList(ctx)
+		if err != nil {
+			logger.Warn("failed to get nodes, retry", zap.Error(err))
+			return false, nil
+		}
+		np, err := p.KaasClient.GetNodePool(ctx, cluster, purged.NodePool, nodes)
+		if err != nil {
+			logger.Warn("failed to get node-pool, retry", zap.Error(err))
+			return false, nil
+		}
+		ready, status = 0, np.Status
+		for _, n := range np.Nodes {
+			// the replacement may have the same name as the purged node
+			if n.Ready && n.key() != purged.key() {
+				ready++
+			}
+		}
+		return ready >= want && status == statusNodePoolStable, nil
+	}, ctx.Done())
+	if err != nil {
+		return fmt.Errorf("timed out waiting for the replacement of %s: %d/%d ready nodes, status %s: %w",
+			purged.Name, ready, want, status, err)
 	}
 	return nil
 }
 
-func (p Thyella) purgeInGroup(ctx context.Context, cluster string, group []string, nodes []*Node, nodeEachPools map[string]*Node) (*Node, bool, error) {
+// readyNodes returns the number of ready nodes in the node-pool.
+func readyNodes(nodes []*Node, pool string) int {
+	cnt := 0
+	for _, n := range nodes {
+		if n.NodePool == pool && n.Ready {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// purgeNode drain & delete the node within the drain timeout of the node-pool.
+func (p Thyella) purgeNode(ctx context.Context, node *Node) error {
+	pc := p.Config.PoolConfig(node.NodePool)
+	if pc.DrainTimeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pc.DrainTimeout.Duration)
+		defer cancel()
+	}
+	return p.K8sClient.Purge(ctx, node)
+}
+
+// planInGroup decides a node to purge in the node-pool group.
+// The node-pools which have no disruption budget are skipped.
+func (p Thyella) planInGroup(ctx context.Context, cluster string, group []string, nodes []*Node, nodeEachPools map[string]*Node, budget *disruptionBudget) (*Plan, error) {
+	plan := &Plan{Group: group}
+	logger := loggerFrom(ctx, p.Logger).With(zap.String("phase", phasePlan), zap.Strings("group", group))
+
+	// check before any disruptive action
+	reason, ok, err := p.Config.maintenance().check(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		logger.Info("skipped node-pool group", zap.String("reason", string(reason)))
+		for _, pool := range group {
+			plan.skip(pool, reason)
+		}
+		plan.Reason = reason
+		return plan, nil
+	}
+
 	npg := NodePoolGroup{
 		NodePools: make([]*NodePool, 0),
 	}
 	for _, pool := range group {
 		if _, ok := nodeEachPools[pool]; !ok {
+			plan.skip(pool, ReasonNoNodes)
 			continue
 		}
 
 		np, err := p.KaasClient.GetNodePool(ctx, cluster, pool, nodes)
 		if err != nil {
-			return nil, false, err
+			return nil, err
+		}
+		pc := p.Config.PoolConfig(pool)
+		np.ExcludeNodes = pc.ExcludeNodes
+		np.MinAge = pc.MinAge.Duration
+		for _, e := range np.Exclusions() {
+			logger.Info("excluded node",
+				zap.String("node", e.Node),
+				zap.String("pool", e.NodePool),
+				zap.String("reason", string(e.Reason)),
+				zap.Strings("pods", e.Pods),
+			)
+			plan.Excluded = append(plan.Excluded, e)
 		}
 		npg.NodePools = append(npg.NodePools, np)
 	}
 
-	log.Printf("processing node-pool group: %s\n", npg)
+	logger.Debug("processing node-pool group", zap.Stringer("node_pools", npg))
 
 	ready := true
 	for _, np := range npg.NodePools {
 		if !np.AllGreen() {
-			log.Printf("skipped: %s is unhealthy.\n", np.Name)
+			logger.Info("skipped unhealthy node-pool", zap.String("pool", np.Name))
+			plan.skip(np.Name, ReasonUnhealthy)
 			ready = false
 		}
 	}
 	if !ready {
-		return nil, false, nil
+		plan.Reason = ReasonUnhealthy
+		return plan, nil
 	}
 
-	// purge node in non-preemptible pool
-	if np, ok := npg.GetPoolWithPreemptible(false); ok {
-		if !np.IsMinimumNodes() {
-			target, _ := np.GetMaxAgeNodeWithBalance()
-			if err := p.K8sClient.Purge(ctx, target); err != nil {
-				return nil, false, fmt.Errorf("failed to purge node: %s %w", target.Name, err)
-			}
-			if err := p.KaasClient.DeleteInstance(ctx, cluster, target); err != nil {
-				return nil, false, fmt.Errorf("failed to delete instance: %s %w", target.Name, err)
-			}
-			return target, true, nil
+	rules := p.Config.selectionRules()
+	ruled := make(map[CapacityType]bool)
+	for _, r := range rules {
+		ruled[r.CapacityType] = true
+	}
+	for _, np := range npg.NodePools {
+		if !ruled[np.Capacity()] {
+			plan.skip(np.Name, ReasonNoSelectionRule)
 		}
 	}
 
-	// purge node in preemptible pool
-	if np, ok := npg.GetPoolWithPreemptible(true); ok {
-		if target, ok := np.GetMaxAgeNode(); ok {
-			if err := p.K8sClient.Purge(ctx, target); err != nil {
-				return nil, false, fmt.Errorf("failed to purge node: %s %w", target.Name, err)
-			}
-			if err := p.KaasClient.DeleteInstance(ctx, cluster, target); err != nil {
-				return nil, false, fmt.Errorf("failed to delete instance: %s %w", target.Name, err)
-			}
-			return target, true, nil
+	// purge node in the node-pool of each capacity type in order
+	for _, r := range rules {
+		np, ok := npg.GetPoolWithCapacityType(r.CapacityType)
+		if !ok {
+			continue
+		}
+		if !budget.allowed(np.Name) {
+			plan.skip(np.Name, ReasonBudgetExhausted)
+		} else if r.RespectMinimumNodes && np.IsMinimumNodes() {
+			plan.skip(np.Name, ReasonMinimumNodes)
+		} else if target, reason, ok := r.choose(np); !ok {
+			plan.skip(np.Name, ReasonNoCandidate)
+		} else if r.RespectMinimumNodes && np.IsMinimumNodesInZone(target.Zone) {
+			plan.skip(np.Name, ReasonMinimumNodes)
+		} else {
+			plan.choose(np, target, reason)
+			return plan, nil
 		}
 	}
 
-	// not found a purgeable node
-	return nil, false, nil
+	plan.Reason = ReasonNoCandidate
+	return plan, nil
 }
@@ -2,20 +2,30 @@ package thyella
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// deleted returns the state of the instance deleted successfully.
+func deleted(n *Node) *InstanceState {
+	return &InstanceState{Node: n.Name, Operation: "op", OperationStatus: "DONE", Status: InstanceStatusDeleted}
+}
+
 func TestRun(t *testing.T) {
 	ctx := context.Background()
 
 	type Args struct {
 		cluster string
-		nps     []string
+		groups  [][]string
 	}
 
 	var (
@@ -27,78 +37,85 @@ func TestRun(t *testing.T) {
 
 		args = Args{
 			cluster: "cluster",
-			nps: []string{
-				"pa",
-				"pb",
+			groups: [][]string{
+				{"pa", "pb"},
 			},
 		}
 	)
 
+	one := intstr.FromInt(1)
+
 	tests := []struct {
 		name     string
 		input    Args
+		config   *Config
 		wantMock func(*MockKaasProvider, *MockK8sAccessor)
 	}{
 		{
 			name:  "should purge 'pa' and 'pb'",
 			input: args,
 			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
-				k8s.EXPECT().GetNodeList(ctx).Return([]*Node{nodeA, nodeB, nodeC}, nil)
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return([]*Node{nodeA, nodeB, nodeC}, nil)
 
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pa", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
 					Name:         "pa",
 					Nodes:        []*Node{nodeA},
 					MinNodeCount: 0,
 					Status:       statusNodePoolStable,
 				}, nil)
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pb", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
 					Name:        "pb",
 					Nodes:       []*Node{nodeB},
 					Preemptible: true,
 					Status:      statusNodePoolStable,
 				}, nil)
-				k8s.EXPECT().Purge(ctx, nodeA).Return(nil)
-				kaas.EXPECT().DeleteInstance(ctx, "cluster", nodeA).Return(nil)
+				k8s.EXPECT().Purge(gomock.Any(), nodeA).Return(nil)
+				kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeA).Return(deleted(nodeA), nil)
+				k8s.EXPECT().Event(nodeA, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any())
 			},
 		},
 		{
-			name:  "should purge only the 'pa'",
-			input: args,
+			name:   "should purge only the 'pa' within the global budget",
+			input:  args,
+			config: &Config{MaxUnavailable: &one},
 			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
-				k8s.EXPECT().GetNodeList(ctx).Return([]*Node{nodeA, nodeB, nodeC}, nil)
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return([]*Node{nodeA, nodeB, nodeC}, nil)
 
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pa", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
 					Name:         "pa",
 					Nodes:        []*Node{nodeA},
 					MinNodeCount: 0,
 					Status:       statusNodePoolStable,
 				}, nil)
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pb", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
 					Name:        "pb",
 					Nodes:       []*Node{nodeB},
 					Preemptible: true,
 					Status:      statusNodePoolStable,
 				}, nil)
-				k8s.EXPECT().Purge(ctx, nodeA).Return(nil)
-				kaas.EXPECT().DeleteInstance(ctx, "cluster", nodeA).Return(nil)
+				k8s.EXPECT().Purge(gomock.Any(), nodeA).Return(nil)
+				kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeA).Return(deleted(nodeA), nil)
+				k8s.EXPECT().Event(nodeA, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any())
 			},
 		},
 		{
 			name:  "should non purge when running the minimum nodes",
 			input: args,
 			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
-				k8s.EXPECT().GetNodeList(ctx).Return([]*Node{nodeA, nodeB, nodeC}, nil)
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return([]*Node{nodeA, nodeB, nodeC}, nil)
 
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pa", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
 					Name:         "pa",
 					Nodes:        []*Node{nodeA},
+					Autoscale:    true,
 					MinNodeCount: 1,
 					ZoneURLs:     []string{"1"},
 					Status:       statusNodePoolStable,
 				}, nil)
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pb", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
 					Name:         "pb",
 					Nodes:        []*Node{nodeB},
+					Autoscale:    true,
 					MinNodeCount: 1,
 					ZoneURLs:     []string{"1"},
 					Status:       statusNodePoolStable,
@@ -118,14 +135,260 @@ func TestRun(t *testing.T) {
 			thyella := Thyella{
 				KaasClient: mockKaasClient,
 				K8sClient:  mockK8sClient,
+				Config:     tt.config,
 			}
 
-			err := thyella.Purge(tt.input.cluster, tt.input.nps)
+			_, err := thyella.Purge(ctx, tt.input.cluster, tt.input.groups)
 			assert.NoError(t, err)
 		})
 	}
 }
 
+func TestPurgeMultipleGroups(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		nodeA = &Node{Name: "na", NodePool: "pa", Ready: true}
+		nodeB = &Node{Name: "nb", NodePool: "pb", Ready: true}
+		nodeC = &Node{Name: "nc", NodePool: "pc", Ready: true}
+		nodeD = &Node{Name: "nd", NodePool: "pd", Ready: true}
+
+		nodes = []*Node{nodeA, nodeB, nodeC, nodeD}
+	)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	kaas := NewMockKaasProvider(ctrl)
+	k8s := NewMockK8sAccessor(ctrl)
+
+	k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil)
+	// group [pa, pb] fails to purge
+	kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+		Name:   "pa",
+		Nodes:  []*Node{nodeA},
+		Status: statusNodePoolStable,
+	}, nil)
+	kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+		Name:        "pb",
+		Nodes:       []*Node{nodeB},
+		Preemptible: true,
+		Status:      statusNodePoolStable,
+	}, nil)
+	k8s.EXPECT().Purge(gomock.Any(), nodeA).Return(errors.New("drain error"))
+	// group [pc, pd] is purged regardless of the previous group
+	kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pc", nodes).Return(&NodePool{
+		Name:   "pc",
+		Nodes:  []*Node{nodeC},
+		Status: statusNodePoolStable,
+	}, nil)
+	kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pd", nodes).Return(&NodePool{
+		Name:        "pd",
+		Nodes:       []*Node{nodeD},
+		Preemptible: true,
+		Status:      statusNodePoolStable,
+	}, nil)
+	k8s.EXPECT().Purge(gomock.Any(), nodeC).Return(nil)
+	kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeC).Return(deleted(nodeC), nil)
+	k8s.EXPECT().Event(nodeC, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any())
+
+	failed := testutil.ToFloat64(purges.WithLabelValues("pa", "failed"))
+	succeeded := testutil.ToFloat64(purges.WithLabelValues("pc", "succeeded"))
+
+	thyella := Thyella{
+		KaasClient: kaas,
+		K8sClient:  k8s,
+	}
+	results, err := thyella.Purge(ctx, "cluster", [][]string{{"pa", "pb"}, {"pc", "pd"}})
+	assert.Error(t, err)
+	assert.Equal(t, failed+1, testutil.ToFloat64(purges.WithLabelValues("pa", "failed")))
+	assert.Equal(t, succeeded+1, testutil.ToFloat64(purges.WithLabelValues("pc", "succeeded")))
+	assert.Len(t, results, 2)
+	assert.Error(t, results[0].Err)
+	assert.Empty(t, results[0].Nodes)
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, []*Node{nodeC}, results[1].Nodes)
+	assert.Equal(t, []*InstanceState{deleted(nodeC)}, results[1].Instances)
+}
+
+func TestPurgeWithDisruptionBudget(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		nodeA1 = &Node{Name: "na1", NodePool: "pa", Ready: true, Age: 3, Zone: "za"}
+		nodeA2 = &Node{Name: "na2", NodePool: "pa", Ready: true, Age: 2, Zone: "za"}
+		nodeA3 = &Node{Name: "na3", NodePool: "pa", Ready: true, Age: 1, Zone: "za"}
+
+		nodes = []*Node{nodeA1, nodeA2, nodeA3}
+	)
+	two := intstr.FromInt(2)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	kaas := NewMockKaasProvider(ctrl)
+	k8s := NewMockK8sAccessor(ctrl)
+
+	gomock.InOrder(
+		k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil),
+		kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+			Name:     "pa",
+			Nodes:    nodes,
+			ZoneURLs: []string{"1"},
+			Status:   statusNodePoolStable,
+		}, nil),
+		k8s.EXPECT().Purge(gomock.Any(), nodeA1).Return(nil),
+		kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeA1).Return(deleted(nodeA1), nil),
+		k8s.EXPECT().Event(nodeA1, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any()),
+		// re-evaluate without the purged node, the lister may still have it
+		k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil),
+		kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", []*Node{nodeA2, nodeA3}).Return(&NodePool{
+			Name:     "pa",
+			Nodes:    []*Node{nodeA2, nodeA3},
+			ZoneURLs: []string{"1"},
+			Status:   statusNodePoolStable,
+		}, nil),
+		k8s.EXPECT().Purge(gomock.Any(), nodeA2).Return(nil),
+		kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeA2).Return(deleted(nodeA2), nil),
+		k8s.EXPECT().Event(nodeA2, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any()),
+	)
+
+	thyella := Thyella{
+		KaasClient: kaas,
+		K8sClient:  k8s,
+		Config: &Config{
+			NodePoolGroups: [][]string{{"pa"}},
+			NodePools:      []*PoolConfig{{Name: "pa", MaxUnavailable: &two}},
+		},
+	}
+	results, err := thyella.Purge(ctx, "cluster", [][]string{{"pa"}})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, []*Node{nodeA1, nodeA2}, results[0].Nodes)
+}
+
+func TestPurgeWithFailedRefetch(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		nodeA1 = &Node{Name: "na1", NodePool: "pa", Ready: true, Age: 2, Zone: "za"}
+		nodeA2 = &Node{Name: "na2", NodePool: "pa", Ready: true, Age: 1, Zone: "za"}
+		nodeB  = &Node{Name: "nb", NodePool: "pb", Ready: true, Zone: "za"}
+
+		nodes = []*Node{nodeA1, nodeA2, nodeB}
+	)
+	two := intstr.FromInt(2)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	kaas := NewMockKaasProvider(ctrl)
+	k8s := NewMockK8sAccessor(ctrl)
+
+	gomock.InOrder(
+		k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil),
+		kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+			Name:     "pa",
+			Nodes:    []*Node{nodeA1, nodeA2},
+			ZoneURLs: []string{"1"},
+			Status:   statusNodePoolStable,
+		}, nil),
+		k8s.EXPECT().Purge(gomock.Any(), nodeA1).Return(nil),
+		kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeA1).Return(deleted(nodeA1), nil),
+		k8s.EXPECT().Event(nodeA1, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any()),
+		k8s.EXPECT().GetNodeList(gomock.Any()).Return(nil, errors.New("list error")),
+		// group [pb] is evaluated with the nodes fetched before
+		kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+			Name:     "pb",
+			Nodes:    []*Node{nodeB},
+			ZoneURLs: []string{"1"},
+			Status:   statusNodePoolStable,
+		}, nil),
+		k8s.EXPECT().Purge(gomock.Any(), nodeB).Return(nil),
+		kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeB).Return(deleted(nodeB), nil),
+		k8s.EXPECT().Event(nodeB, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any()),
+	)
+
+	thyella := Thyella{
+		KaasClient: kaas,
+		K8sClient:  k8s,
+		Config: &Config{
+			NodePoolGroups: [][]string{{"pa"}, {"pb"}},
+			NodePools:      []*PoolConfig{{Name: "pa", MaxUnavailable: &two}},
+		},
+	}
+	results, err := thyella.Purge(ctx, "cluster", [][]string{{"pa"}, {"pb"}})
+	assert.Error(t, err)
+	assert.Len(t, results, 2)
+	assert.Error(t, results[0].Err)
+	assert.Equal(t, []*Node{nodeA1}, results[0].Nodes)
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, []*Node{nodeB}, results[1].Nodes)
+}
+
+func TestPurgeWithDisruptionBudgetOfEachPool(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		nodeA  = &Node{Name: "na", NodePool: "pa", Ready: true, Zone: "za"}
+		nodeB1 = &Node{Name: "nb1", NodePool: "pb", Ready: true, Age: 3, Zone: "za"}
+		nodeB2 = &Node{Name: "nb2", NodePool: "pb", Ready: true, Age: 2, Zone: "za"}
+		nodeB3 = &Node{Name: "nb3", NodePool: "pb", Ready: true, Age: 1, Zone: "za"}
+
+		nodes = []*Node{nodeA, nodeB1, nodeB2, nodeB3}
+	)
+	two := intstr.FromInt(2)
+	poolB := func(nodes ...*Node) *NodePool {
+		return &NodePool{
+			Name:        "pb",
+			Nodes:       nodes,
+			Preemptible: true,
+			ZoneURLs:    []string{"1"},
+			Status:      statusNodePoolStable,
+		}
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	kaas := NewMockKaasProvider(ctrl)
+	k8s := NewMockK8sAccessor(ctrl)
+
+	gomock.InOrder(
+		k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil),
+		kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+			Name:     "pa",
+			Nodes:    []*Node{nodeA},
+			ZoneURLs: []string{"1"},
+			Status:   statusNodePoolStable,
+		}, nil),
+		kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(poolB(nodeB1, nodeB2, nodeB3), nil),
+		k8s.EXPECT().Purge(gomock.Any(), nodeA).Return(nil),
+		kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeA).Return(deleted(nodeA), nil),
+		k8s.EXPECT().Event(nodeA, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any()),
+		// 'pa' exhausted its budget, 'pb' still has the budget
+		k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil),
+		kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", []*Node{nodeB1, nodeB2, nodeB3}).Return(poolB(nodeB1, nodeB2, nodeB3), nil),
+		k8s.EXPECT().Purge(gomock.Any(), nodeB1).Return(nil),
+		kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeB1).Return(deleted(nodeB1), nil),
+		k8s.EXPECT().Event(nodeB1, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any()),
+		k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil),
+		kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", []*Node{nodeB2, nodeB3}).Return(poolB(nodeB2, nodeB3), nil),
+		k8s.EXPECT().Purge(gomock.Any(), nodeB2).Return(nil),
+		kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeB2).Return(deleted(nodeB2), nil),
+		k8s.EXPECT().Event(nodeB2, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any()),
+	)
+
+	thyella := Thyella{
+		KaasClient: kaas,
+		K8sClient:  k8s,
+		Config: &Config{
+			NodePoolGroups: [][]string{{"pa", "pb"}},
+			NodePools:      []*PoolConfig{{Name: "pb", MaxUnavailable: &two}},
+		},
+	}
+	results, err := thyella.Purge(ctx, "cluster", [][]string{{"pa", "pb"}})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, []*Node{nodeA, nodeB1, nodeB2}, results[0].Nodes)
+}
+
 func TestPurgeInGroup(t *testing.T) {
 	ctx := context.Background()
 
@@ -147,6 +410,7 @@ func TestPurgeInGroup(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    input
+		config   *Config
 		wantMock func(*MockKaasProvider, *MockK8sAccessor)
 		wantNode *Node
 	}{
@@ -161,22 +425,23 @@ func TestPurgeInGroup(t *testing.T) {
 				},
 			},
 			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pa", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
 					Name:         "pa",
 					MinNodeCount: 0,
 					Nodes:        []*Node{nodeA},
 					ZoneURLs:     []string{"1"},
 					Status:       statusNodePoolStable,
 				}, nil)
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pb", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
 					Name:        "pb",
 					Nodes:       []*Node{nodeB},
 					Preemptible: true,
 					ZoneURLs:    []string{"1"},
 					Status:      statusNodePoolStable,
 				}, nil)
-				k8s.EXPECT().Purge(ctx, nodeA).Return(nil)
-				kaas.EXPECT().DeleteInstance(ctx, "cluster", nodeA).Return(nil)
+				k8s.EXPECT().Purge(gomock.Any(), nodeA).Return(nil)
+				kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeA).Return(deleted(nodeA), nil)
+				k8s.EXPECT().Event(nodeA, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any())
 			},
 			wantNode: nodeA,
 		},
@@ -191,14 +456,15 @@ func TestPurgeInGroup(t *testing.T) {
 				},
 			},
 			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pa", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
 					Name:         "pa",
+					Autoscale:    true,
 					MinNodeCount: 2,
 					Nodes:        []*Node{nodeA},
 					ZoneURLs:     []string{"1"},
 					Status:       statusNodePoolStable,
 				}, nil)
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pb", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
 					Name:         "pb",
 					Nodes:        []*Node{nodeB},
 					Preemptible:  true,
@@ -206,11 +472,77 @@ func TestPurgeInGroup(t *testing.T) {
 					ZoneURLs:     []string{"1"},
 					Status:       statusNodePoolStable,
 				}, nil)
-				k8s.EXPECT().Purge(ctx, nodeB).Return(nil)
-				kaas.EXPECT().DeleteInstance(ctx, "cluster", nodeB).Return(nil)
+				k8s.EXPECT().Purge(gomock.Any(), nodeB).Return(nil)
+				kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeB).Return(deleted(nodeB), nil)
+				k8s.EXPECT().Event(nodeB, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any())
+			},
+			wantNode: nodeB,
+		},
+		{
+			name: "should purge 'nodeB' when 'nodeA' is excluded by the config",
+			input: input{
+				group: []string{"pa", "pb"},
+				nodes: []*Node{nodeA, nodeB, nodeC},
+				nep: map[string]*Node{
+					"pa": nodeA,
+					"pb": nodeB,
+				},
+			},
+			config: &Config{
+				NodePools: []*PoolConfig{{Name: "pa", ExcludeNodes: []string{"na"}}},
+			},
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+					Name:     "pa",
+					Nodes:    []*Node{nodeA},
+					ZoneURLs: []string{"1"},
+					Status:   statusNodePoolStable,
+				}, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+					Name:        "pb",
+					Nodes:       []*Node{nodeB},
+					Preemptible: true,
+					ZoneURLs:    []string{"1"},
+					Status:      statusNodePoolStable,
+				}, nil)
+				k8s.EXPECT().Purge(gomock.Any(), nodeB).Return(nil)
+				kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeB).Return(deleted(nodeB), nil)
+				k8s.EXPECT().Event(nodeB, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any())
 			},
 			wantNode: nodeB,
 		},
+		{
+			name: "should non purge when the preemptible node is younger than the min age",
+			input: input{
+				group: []string{"pa", "pb"},
+				nodes: []*Node{nodeA, nodeB, nodeC},
+				nep: map[string]*Node{
+					"pa": nodeA,
+					"pb": nodeB,
+				},
+			},
+			config: &Config{
+				NodePools: []*PoolConfig{{Name: "pb", MinAge: metav1.Duration{Duration: time.Hour}}},
+			},
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+					Name:         "pa",
+					Autoscale:    true,
+					MinNodeCount: 2,
+					Nodes:        []*Node{nodeA},
+					ZoneURLs:     []string{"1"},
+					Status:       statusNodePoolStable,
+				}, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+					Name:        "pb",
+					Nodes:       []*Node{nodeB},
+					Preemptible: true,
+					ZoneURLs:    []string{"1"},
+					Status:      statusNodePoolStable,
+				}, nil)
+			},
+			wantNode: nil,
+		},
 		{
 			name: "should non purge when unhealthy node",
 			input: input{
@@ -222,13 +554,40 @@ func TestPurgeInGroup(t *testing.T) {
 				},
 			},
 			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pa", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
 					Name:     "pa",
 					Nodes:    []*Node{nodeA, nodeC},
 					ZoneURLs: []string{"1"},
 					Status:   statusNodePoolStable,
 				}, nil)
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pb", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+					Name:        "pb",
+					Nodes:       []*Node{nodeB},
+					Preemptible: true,
+					ZoneURLs:    []string{"1"},
+					Status:      statusNodePoolStable,
+				}, nil)
+			},
+			wantNode: nil,
+		},
+		{
+			name: "should non purge when the node is under pressure",
+			input: input{
+				group: []string{"pa", "pb"},
+				nodes: []*Node{nodeA, nodeB, nodeC},
+				nep: map[string]*Node{
+					"pa": nodeA,
+					"pb": nodeB,
+				},
+			},
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+					Name:     "pa",
+					Nodes:    []*Node{{Name: "nd", NodePool: "pa", Ready: true, MemoryPressure: true}},
+					ZoneURLs: []string{"1"},
+					Status:   statusNodePoolStable,
+				}, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
 					Name:        "pb",
 					Nodes:       []*Node{nodeB},
 					Preemptible: true,
@@ -249,13 +608,13 @@ func TestPurgeInGroup(t *testing.T) {
 				},
 			},
 			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pa", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
 					Name:     "pa",
 					Nodes:    []*Node{nodeA},
 					ZoneURLs: []string{"1"},
 					Status:   statusNodePoolStable,
 				}, nil)
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pb", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
 					Name:        "pb",
 					Nodes:       []*Node{nodeB},
 					Preemptible: true,
@@ -277,9 +636,10 @@ func TestPurgeInGroup(t *testing.T) {
 			purger := Thyella{
 				KaasClient: mockKaasClient,
 				K8sClient:  mockK8sClient,
+				Config:     tt.config,
 			}
 
-			got, _, err := purger.purgeInGroup(ctx, "cluster", tt.input.group, tt.input.nodes, tt.input.nep)
+			got, _, _, err := purger.purgeInGroup(ctx, "cluster", tt.input.group, tt.input.nodes, tt.input.nep, nil)
 			assert.NoError(t, err)
 			if tt.wantNode == nil {
 				assert.Nil(t, got)
@@ -323,15 +683,37 @@ func TestPurgeInGroupWithBalanced(t *testing.T) {
 				nep:   map[string]*Node{"pa": nodeA},
 			},
 			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
-				kaas.EXPECT().GetNodePool(ctx, "cluster", "pa", nodes).Return(&NodePool{
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
 					Name:         "pa",
 					Nodes:        []*Node{nodeA, nodeB, nodeC},
 					MinNodeCount: 0,
 					ZoneURLs:     []string{"1", "2"},
 					Status:       statusNodePoolStable,
 				}, nil)
-				k8s.EXPECT().Purge(ctx, nodeB).Return(nil)
-				kaas.EXPECT().DeleteInstance(ctx, "cluster", nodeB).Return(nil)
+				k8s.EXPECT().Purge(gomock.Any(), nodeB).Return(nil)
+				kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeB).Return(deleted(nodeB), nil)
+				k8s.EXPECT().Event(nodeB, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any())
+			},
+		},
+		{
+			name: "should purge 'nodeA' when 'nodeB' is opted-out by annotations",
+			input: input{
+				group: []string{"pa"},
+				nodes: []*Node{nodeA, nodeB, nodeC},
+				nep:   map[string]*Node{"pa": nodeA},
+			},
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				optedOut := &Node{Name: "nb", NodePool: "pa", Ready: true, Age: time.Duration(2), Zone: "za", DoNotDisruptPods: []string{"default/job"}}
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+					Name:         "pa",
+					Nodes:        []*Node{nodeA, optedOut, nodeC},
+					MinNodeCount: 0,
+					ZoneURLs:     []string{"1", "2"},
+					Status:       statusNodePoolStable,
+				}, nil)
+				k8s.EXPECT().Purge(gomock.Any(), nodeA).Return(nil)
+				kaas.EXPECT().DeleteInstance(gomock.Any(), "cluster", nodeA).Return(deleted(nodeA), nil)
+				k8s.EXPECT().Event(nodeA, corev1.EventTypeNormal, EventReasonInstanceDeleted, gomock.Any())
 			},
 		},
 	}
@@ -349,8 +731,287 @@ func TestPurgeInGroupWithBalanced(t *testing.T) {
 				K8sClient:  mockK8sClient,
 			}
 
-			_, _, err := purger.purgeInGroup(ctx, "cluster", tt.input.group, tt.input.nodes, tt.input.nep)
+			_, _, _, err := purger.purgeInGroup(ctx, "cluster", tt.input.group, tt.input.nodes, tt.input.nep, nil)
 			assert.NoError(t, err)
 		})
 	}
 }
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		nodeA = &Node{Name: "na", NodePool: "pa", Ready: true, Zone: "za"}
+		nodeB = &Node{Name: "nb", NodePool: "pb", Ready: true, Zone: "zb"}
+
+		nodes = []*Node{nodeA, nodeB}
+	)
+
+	tests := []struct {
+		name     string
+		config   *Config
+		wantMock func(*MockKaasProvider, *MockK8sAccessor)
+		want     *Plan
+	}{
+		{
+			name: "should plan 'nodeB' when the non-preemptible pool is minimum nodes",
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+					Name:         "pa",
+					Autoscale:    true,
+					MinNodeCount: 1,
+					Nodes:        []*Node{nodeA},
+					ZoneURLs:     []string{"1"},
+					Status:       statusNodePoolStable,
+				}, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+					Name:        "pb",
+					Nodes:       []*Node{nodeB},
+					Preemptible: true,
+					ZoneURLs:    []string{"1"},
+					Status:      statusNodePoolStable,
+				}, nil)
+			},
+			want: &Plan{
+				Group:    []string{"pa", "pb"},
+				Target:   nodeB,
+				NodePool: "pb",
+				Reason:   ReasonOldestNode,
+				Skipped: []*SkippedPool{
+					{NodePool: "pa", Reason: ReasonMinimumNodes},
+				},
+			},
+		},
+		{
+			name: "should plan nothing when unhealthy node pool",
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+					Name:     "pa",
+					Nodes:    []*Node{nodeA},
+					ZoneURLs: []string{"1"},
+					Status:   "unknown",
+				}, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+					Name:        "pb",
+					Nodes:       []*Node{nodeB},
+					Preemptible: true,
+					ZoneURLs:    []string{"1"},
+					Status:      statusNodePoolStable,
+				}, nil)
+			},
+			want: &Plan{
+				Group:  []string{"pa", "pb"},
+				Reason: ReasonUnhealthy,
+				Skipped: []*SkippedPool{
+					{NodePool: "pa", Reason: ReasonUnhealthy},
+				},
+			},
+		},
+		{
+			name: "should plan 'nodeB' when the Spot pool is purged like preemptible",
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+					Name:         "pa",
+					Autoscale:    true,
+					MinNodeCount: 1,
+					Nodes:        []*Node{nodeA},
+					ZoneURLs:     []string{"1"},
+					Status:       statusNodePoolStable,
+				}, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+					Name:         "pb",
+					Nodes:        []*Node{nodeB},
+					CapacityType: CapacityTypeSpot,
+					ZoneURLs:     []string{"1"},
+					Status:       statusNodePoolStable,
+				}, nil)
+			},
+			want: &Plan{
+				Group:    []string{"pa", "pb"},
+				Target:   nodeB,
+				NodePool: "pb",
+				Reason:   ReasonOldestNode,
+				Skipped: []*SkippedPool{
+					{NodePool: "pa", Reason: ReasonMinimumNodes},
+				},
+			},
+		},
+		{
+			name: "should plan 'nodeA' by the configured selection rules",
+			config: &Config{
+				Selection: []SelectionRule{
+					{CapacityType: CapacityTypeOnDemand, Strategy: SelectionOldest},
+				},
+			},
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", nodes).Return(&NodePool{
+					Name:         "pa",
+					Autoscale:    true,
+					MinNodeCount: 1,
+					Nodes:        []*Node{nodeA},
+					ZoneURLs:     []string{"1"},
+					Status:       statusNodePoolStable,
+				}, nil)
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pb", nodes).Return(&NodePool{
+					Name:        "pb",
+					Nodes:       []*Node{nodeB},
+					Preemptible: true,
+					ZoneURLs:    []string{"1"},
+					Status:      statusNodePoolStable,
+				}, nil)
+			},
+			want: &Plan{
+				Group:    []string{"pa", "pb"},
+				Target:   nodeA,
+				NodePool: "pa",
+				Reason:   ReasonOldestNode,
+				Skipped: []*SkippedPool{
+					{NodePool: "pb", Reason: ReasonNoSelectionRule},
+				},
+			},
+		},
+		{
+			name: "should plan nothing in blackout period",
+			config: &Config{
+				Maintenance: MaintenanceConfig{
+					Blackouts: []Blackout{{Start: "2000-01-01", End: "2999-12-31"}},
+				},
+			},
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return(nodes, nil)
+			},
+			want: &Plan{
+				Group:  []string{"pa", "pb"},
+				Reason: ReasonBlackout,
+				Skipped: []*SkippedPool{
+					{NodePool: "pa", Reason: ReasonBlackout},
+					{NodePool: "pb", Reason: ReasonBlackout},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockKaasClient := NewMockKaasProvider(ctrl)
+			mockK8sClient := NewMockK8sAccessor(ctrl)
+			tt.wantMock(mockKaasClient, mockK8sClient)
+
+			thyella := Thyella{
+				KaasClient: mockKaasClient,
+				K8sClient:  mockK8sClient,
+				Config:     tt.config,
+			}
+
+			got, err := thyella.Plan(ctx, "cluster", [][]string{{"pa", "pb"}})
+			assert.NoError(t, err)
+			assert.Equal(t, []*Plan{tt.want}, got)
+		})
+	}
+}
+
+func TestWaitForReplacement(t *testing.T) {
+	defer func(d time.Duration) { replacementPollInterval = d }(replacementPollInterval)
+	replacementPollInterval = time.Millisecond
+
+	var (
+		purged   = &Node{Name: "na", UID: "ua", NodePool: "pa", Ready: true}
+		existing = &Node{Name: "nb", UID: "ub", NodePool: "pa", Ready: true}
+		joining  = &Node{Name: "nc", UID: "uc", NodePool: "pa"}
+		joined   = &Node{Name: "nc", UID: "uc", NodePool: "pa", Ready: true}
+		// MIGs recreate the instance with the same name
+		recreated = &Node{Name: "na", UID: "ua2", NodePool: "pa", Ready: true}
+	)
+	config := &Config{
+		NodePools: []*PoolConfig{{Name: "pa", ReplacementTimeout: metav1.Duration{Duration: 100 * time.Millisecond}}},
+	}
+
+	tests := []struct {
+		name     string
+		config   *Config
+		wantMock func(*MockKaasProvider, *MockK8sAccessor)
+		wantErr  bool
+	}{
+		{
+			name:     "disabled",
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {},
+		},
+		{
+			name:   "replacement node joined",
+			config: config,
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				gomock.InOrder(
+					k8s.EXPECT().GetNodeList(gomock.Any()).Return([]*Node{existing, joining}, nil),
+					kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", gomock.Any()).Return(&NodePool{
+						Name:   "pa",
+						Nodes:  []*Node{existing, joining},
+						Status: "RECONCILING",
+					}, nil),
+					k8s.EXPECT().GetNodeList(gomock.Any()).Return([]*Node{existing, joined}, nil),
+					kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", gomock.Any()).Return(&NodePool{
+						Name:   "pa",
+						Nodes:  []*Node{existing, joined},
+						Status: statusNodePoolStable,
+					}, nil),
+				)
+			},
+		},
+		{
+			name:   "replacement node joined with the same name",
+			config: config,
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				gomock.InOrder(
+					k8s.EXPECT().GetNodeList(gomock.Any()).Return([]*Node{existing}, nil),
+					kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", gomock.Any()).Return(&NodePool{
+						Name:   "pa",
+						Nodes:  []*Node{existing},
+						Status: "RECONCILING",
+					}, nil),
+					k8s.EXPECT().GetNodeList(gomock.Any()).Return([]*Node{existing, recreated}, nil),
+					kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", gomock.Any()).Return(&NodePool{
+						Name:   "pa",
+						Nodes:  []*Node{existing, recreated},
+						Status: statusNodePoolStable,
+					}, nil),
+				)
+			},
+		},
+		{
+			name:   "timed out",
+			config: config,
+			wantMock: func(kaas *MockKaasProvider, k8s *MockK8sAccessor) {
+				k8s.EXPECT().GetNodeList(gomock.Any()).Return([]*Node{purged, existing}, nil).AnyTimes()
+				kaas.EXPECT().GetNodePool(gomock.Any(), "cluster", "pa", gomock.Any()).Return(&NodePool{
+					Name:   "pa",
+					Nodes:  []*Node{purged, existing},
+					Status: statusNodePoolStable,
+				}, nil).AnyTimes()
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			kaas := NewMockKaasProvider(ctrl)
+			k8s := NewMockK8sAccessor(ctrl)
+			tt.wantMock(kaas, k8s)
+
+			p := Thyella{KaasClient: kaas, K8sClient: k8s, Config: tt.config}
+			err := p.waitForReplacement(context.Background(), "cluster", purged, 2)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
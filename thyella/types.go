@@ -1,6 +1,7 @@
 package thyella
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -8,24 +9,99 @@ import (
 
 // Node represents node
 type Node struct {
-	Name     string
-	NodePool string
-	Zone     string
-	Age      time.Duration
-	Ready    bool
+	Name string `json:"name"`
+	// UID distinguishes the node from the replacement of the same name.
+	UID      string        `json:"uid,omitempty"`
+	NodePool string        `json:"nodePool"`
+	Zone     string        `json:"zone"`
+	Age      time.Duration `json:"age"`
+	Ready    bool          `json:"ready"`
+	// Spot represents the node is a Spot VM.
+	Spot bool `json:"spot,omitempty"`
+
+	// node conditions indicating problems
+	MemoryPressure     bool `json:"memoryPressure,omitempty"`
+	DiskPressure       bool `json:"diskPressure,omitempty"`
+	PIDPressure        bool `json:"pidPressure,omitempty"`
+	NetworkUnavailable bool `json:"networkUnavailable,omitempty"`
+
+	// opt-outs by annotations
+	Excluded         bool     `json:"excluded,omitempty"`
+	DoNotDisruptPods []string `json:"doNotDisruptPods,omitempty"`
+}
+
+// MarshalJSON writes the age as a duration string, e.g. "24h0m0s", so that
+// the plan is readable.
+func (n Node) MarshalJSON() ([]byte, error) {
+	type node Node
+	return json.Marshal(struct {
+		node
+		Age string `json:"age"`
+	}{node: node(n), Age: n.Age.String()})
+}
+
+// key returns the identity of the node, the name when the UID is unknown.
+// MIGs recreate the instance with the same name, so the name is not enough.
+func (n *Node) key() string {
+	if n.UID != "" {
+		return n.UID
+	}
+	return n.Name
+}
+
+// Healthy returns the node is ready and has no problems
+func (n *Node) Healthy() bool {
+	return n.Ready && !n.MemoryPressure && !n.DiskPressure && !n.PIDPressure && !n.NetworkUnavailable
 }
 
 const statusNodePoolStable = "RUNNING"
 
+// location policies of the autoscaler
+const (
+	LocationPolicyBalanced = "BALANCED"
+	LocationPolicyAny      = "ANY"
+)
+
 // NodePool represents node-pool
 type NodePool struct {
-	Name         string
-	Autoscale    bool
+	Name      string
+	Autoscale bool
+	// MinNodeCount and MaxNodeCount represent the autoscaling limits per zone.
 	MinNodeCount int
-	Preemptible  bool
+	MaxNodeCount int
+	// TotalMinNodeCount and TotalMaxNodeCount represent the autoscaling
+	// limits of the whole node-pool, used instead of the per zone limits.
+	TotalMinNodeCount int
+	TotalMaxNodeCount int
+	// LocationPolicy represents how the autoscaler distributes nodes across
+	// zones, BALANCED or ANY.
+	LocationPolicy string
+	// InitialNodeCount represents the fixed number of nodes per zone when
+	// the node-pool is not autoscaled.
+	InitialNodeCount int
+	// Preemptible represents the preemptible flag of the node config. Use
+	// Capacity to distinguish Spot VMs.
+	Preemptible bool
+	// CapacityType represents the capacity type of nodes, derived from
+	// Preemptible when empty.
+	CapacityType CapacityType
 	Status       string
 	ZoneURLs     []string
 	Nodes        []*Node
+
+	// ExcludeNodes represents the node names which must not be purged
+	ExcludeNodes []string
+	// MinAge represents the minimum age of the purgeable node
+	MinAge time.Duration
+}
+
+// Exclusion represents the node excluded from the purge candidates
+type Exclusion struct {
+	Node     string `json:"node"`
+	NodePool string `json:"nodePool"`
+	Reason   Reason `json:"reason"`
+	// Pods represents the pods protecting the node, if any.
+	Pods []string `json:"pods,omitempty"`
 }
 
 func (np NodePool) relateNodes(nodes []*Node) []*Node {
@@ -41,7 +117,7 @@ func (np NodePool) relateNodes(nodes []*Node) []*Node {
 // GetMaxAgeNode returns max age node
 func (np *NodePool) GetMaxAgeNode() (*Node, bool) {
 	var max *Node
-	for _, n := range np.Nodes {
+	for _, n := range np.candidates() {
 		if max == nil || max.Age < n.Age {
 			max = n
 		}
@@ -62,23 +138,75 @@ func (np *NodePool) GetMaxAgeNodeWithBalance() (*Node, bool) {
 		nodeEachZone[n.Zone] = append(list, n)
 	}
 
-	maxNumZone := make([]*Node, 0)
+	// choose the oldest node in the most crowded zone that has candidates.
+	var maxAge *Node
+	maxNum := 0
 	for _, ns := range nodeEachZone {
-		if len(maxNumZone) < len(ns) {
-			maxNumZone = ns
+		for _, n := range ns {
+			if _, excluded := np.excludedReason(n); excluded {
+				continue
+			}
+			if maxAge == nil || maxNum < len(ns) || (maxNum == len(ns) && maxAge.Age < n.Age) {
+				maxAge = n
+				maxNum = len(ns)
+			}
 		}
 	}
+	return maxAge, maxAge != nil
+}
 
-	var maxAge *Node
-	for _, n := range maxNumZone {
-		if maxAge == nil || maxAge.Age < n.Age {
-			maxAge = n
+// Exclusions returns the nodes excluded from the purge candidates
+func (np *NodePool) Exclusions() []*Exclusion {
+	ret := make([]*Exclusion, 0)
+	for _, n := range np.Nodes {
+		if reason, ok := np.excludedReason(n); ok {
+			e := &Exclusion{Node: n.Name, NodePool: np.Name, Reason: reason}
+			if reason == ReasonDoNotDisruptPods {
+				e.Pods = n.DoNotDisruptPods
+			}
+			ret = append(ret, e)
 		}
 	}
-	return maxAge, maxAge != nil
+	return ret
+}
+
+func (np *NodePool) candidates() []*Node {
+	ret := make([]*Node, 0)
+	for _, n := range np.Nodes {
+		if _, excluded := np.excludedReason(n); !excluded {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+// excludedReason returns the reason why the node must not be purged
+func (np *NodePool) excludedReason(n *Node) (Reason, bool) {
+	for _, name := range np.ExcludeNodes {
+		if name == n.Name {
+			return ReasonExcludedByConfig, true
+		}
+	}
+	if n.Excluded {
+		return ReasonExcludedByAnnotation, true
+	}
+	if len(n.DoNotDisruptPods) > 0 {
+		return ReasonDoNotDisruptPods, true
+	}
+	if n.Age < np.MinAge {
+		return ReasonYoungerThanMinAge, true
+	}
+	return "", false
 }
 
-// IsMinimumNodes returns running nodes is minimum or not
+// IsMinimumNodes returns running nodes is minimum or not.
+//
+// The floor depends on the mode of the node-pool:
+//   - autoscaled with the total limits: TotalMinNodeCount
+//   - autoscaled with the per zone limits: MinNodeCount of every zone. With
+//     the ANY location policy, see also IsMinimumNodesInZone.
+//   - not autoscaled: a node short of InitialNodeCount of every zone, so that
+//     the purge waits for the replacement of the previous one.
 func (np *NodePool) IsMinimumNodes() bool {
 	readyCnt := 0
 	for _, n := range np.Nodes {
@@ -86,8 +214,35 @@ func (np *NodePool) IsMinimumNodes() bool {
 			readyCnt++
 		}
 	}
-	minNodeWholeZone := np.MinNodeCount * len(np.ZoneURLs)
-	return readyCnt <= minNodeWholeZone
+	zones := len(np.ZoneURLs)
+
+	if !np.Autoscale {
+		floor := np.InitialNodeCount*zones - 1
+		if floor < 0 {
+			floor = 0
+		}
+		return readyCnt <= floor
+	}
+	if np.TotalMinNodeCount > 0 {
+		return readyCnt <= np.TotalMinNodeCount
+	}
+	return readyCnt <= np.MinNodeCount*zones
+}
+
+// IsMinimumNodesInZone returns running nodes in the zone is minimum or not.
+// It applies only to the per zone limits with the ANY location policy, where
+// nodes are not balanced across zones.
+func (np *NodePool) IsMinimumNodesInZone(zone string) bool {
+	if !np.Autoscale || np.TotalMinNodeCount > 0 || np.LocationPolicy != LocationPolicyAny {
+		return false
+	}
+	readyCnt := 0
+	for _, n := range np.Nodes {
+		if n.Ready && n.Zone == zone {
+			readyCnt++
+		}
+	}
+	return readyCnt <= np.MinNodeCount
 }
 
 // AllGreen returns available or not
@@ -96,7 +251,7 @@ func (np *NodePool) AllGreen() bool {
 		return false
 	}
 	for _, n := range np.Nodes {
-		if !n.Ready {
+		if !n.Healthy() {
 			return false
 		}
 	}
@@ -109,10 +264,21 @@ type NodePoolGroup struct {
 	NodePools []*NodePool
 }
 
-// GetPoolWithPreemptible returns node pool specified preemptible status
-func (npg NodePoolGroup) GetPoolWithPreemptible(preemptible bool) (*NodePool, bool) {
+// Capacity returns the capacity type of the node-pool
+func (np *NodePool) Capacity() CapacityType {
+	if np.CapacityType != "" {
+		return np.CapacityType
+	}
+	if np.Preemptible {
+		return CapacityTypePreemptible
+	}
+	return CapacityTypeOnDemand
+}
+
+// GetPoolWithCapacityType returns node pool specified capacity type
+func (npg NodePoolGroup) GetPoolWithCapacityType(t CapacityType) (*NodePool, bool) {
 	for _, n := range npg.NodePools {
-		if n.Preemptible == preemptible {
+		if n.Capacity() == t {
 			return n, true
 		}
 	}
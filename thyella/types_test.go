@@ -0,0 +1,142 @@
+package thyella
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsMinimumNodes(t *testing.T) {
+	zoneURLs := []string{
+		"https://www.googleapis.com/compute/v1/projects/p/zones/za/instanceGroupManagers/grp-a",
+		"https://www.googleapis.com/compute/v1/projects/p/zones/zb/instanceGroupManagers/grp-b",
+	}
+	nodes := func(zones ...string) []*Node {
+		ret := make([]*Node, 0, len(zones))
+		for _, z := range zones {
+			ret = append(ret, &Node{Zone: z, Ready: true})
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name string
+		np   *NodePool
+		want bool
+	}{
+		{
+			name: "per zone minimum",
+			np:   &NodePool{Autoscale: true, MinNodeCount: 1, ZoneURLs: zoneURLs, Nodes: nodes("za", "zb")},
+			want: true,
+		},
+		{
+			name: "above per zone minimum",
+			np:   &NodePool{Autoscale: true, MinNodeCount: 1, ZoneURLs: zoneURLs, Nodes: nodes("za", "za", "zb")},
+			want: false,
+		},
+		{
+			name: "above per zone minimum with ANY policy and an empty zone",
+			np:   &NodePool{Autoscale: true, MinNodeCount: 0, LocationPolicy: LocationPolicyAny, ZoneURLs: zoneURLs, Nodes: nodes("za", "za", "za")},
+			want: false,
+		},
+		{
+			name: "total minimum",
+			np:   &NodePool{Autoscale: true, TotalMinNodeCount: 3, LocationPolicy: LocationPolicyAny, ZoneURLs: zoneURLs, Nodes: nodes("za", "za", "za")},
+			want: true,
+		},
+		{
+			name: "above total minimum",
+			np:   &NodePool{Autoscale: true, TotalMinNodeCount: 3, LocationPolicy: LocationPolicyAny, ZoneURLs: zoneURLs, Nodes: nodes("za", "za", "za", "zb")},
+			want: false,
+		},
+		{
+			name: "fixed size",
+			np:   &NodePool{InitialNodeCount: 2, ZoneURLs: zoneURLs, Nodes: nodes("za", "za", "zb", "zb")},
+			want: false,
+		},
+		{
+			name: "fixed size waiting for the replacement",
+			np:   &NodePool{InitialNodeCount: 2, ZoneURLs: zoneURLs, Nodes: nodes("za", "za", "zb")},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.np.IsMinimumNodes())
+		})
+	}
+}
+
+func TestIsMinimumNodesInZone(t *testing.T) {
+	nodes := func(zones ...string) []*Node {
+		ret := make([]*Node, 0, len(zones))
+		for _, z := range zones {
+			ret = append(ret, &Node{Zone: z, Ready: true})
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name string
+		np   *NodePool
+		zone string
+		want bool
+	}{
+		{
+			name: "zone at per zone minimum with ANY policy",
+			np:   &NodePool{Autoscale: true, MinNodeCount: 1, LocationPolicy: LocationPolicyAny, Nodes: nodes("za", "za", "zb")},
+			zone: "zb",
+			want: true,
+		},
+		{
+			name: "zone above per zone minimum with ANY policy",
+			np:   &NodePool{Autoscale: true, MinNodeCount: 1, LocationPolicy: LocationPolicyAny, Nodes: nodes("za", "za", "zb")},
+			zone: "za",
+			want: false,
+		},
+		{
+			name: "no minimum with ANY policy and an empty zone",
+			np:   &NodePool{Autoscale: true, MinNodeCount: 0, LocationPolicy: LocationPolicyAny, Nodes: nodes("za", "za", "za")},
+			zone: "za",
+			want: false,
+		},
+		{
+			name: "BALANCED policy is checked by the whole node-pool",
+			np:   &NodePool{Autoscale: true, MinNodeCount: 1, LocationPolicy: LocationPolicyBalanced, Nodes: nodes("za", "za", "zb")},
+			zone: "zb",
+			want: false,
+		},
+		{
+			name: "total limits",
+			np:   &NodePool{Autoscale: true, TotalMinNodeCount: 1, LocationPolicy: LocationPolicyAny, Nodes: nodes("za", "za", "zb")},
+			zone: "zb",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.np.IsMinimumNodesInZone(tt.zone))
+		})
+	}
+}
+
+func TestNodeMarshalJSON(t *testing.T) {
+	plan := &Plan{
+		Group:    []string{"pa"},
+		Target:   &Node{Name: "na", NodePool: "pa", Zone: "za", Age: 24 * time.Hour, Ready: true},
+		NodePool: "pa",
+		Reason:   ReasonOldestNode,
+	}
+	b, err := json.Marshal(plan)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"group": ["pa"],
+		"target": {"name": "na", "nodePool": "pa", "zone": "za", "age": "24h0m0s", "ready": true},
+		"nodePool": "pa",
+		"reason": "oldest node in the node-pool"
+	}`, string(b))
+}